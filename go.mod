@@ -5,7 +5,9 @@ go 1.13
 require (
 	github.com/aws/aws-sdk-go v1.31.4
 	github.com/morikuni/aec v1.0.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/spf13/cobra v1.0.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	k8s.io/api v0.19.0
 	k8s.io/apimachinery v0.19.0
 	k8s.io/cli-runtime v0.19.0
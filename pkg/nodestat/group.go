@@ -0,0 +1,122 @@
+package nodestat
+
+import (
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+const (
+	groupByLabelPrefix = "label:"
+
+	totalName = "TOTAL"
+	mixed     = "<mixed>"
+)
+
+func validGroupBy(groupBy string) bool {
+	return strings.HasPrefix(groupBy, groupByLabelPrefix) && len(strings.TrimPrefix(groupBy, groupByLabelPrefix)) != 0
+}
+
+// groupLabel returns the label key of --group-by.
+func (o *NodeStatOptions) groupLabel() string {
+	return strings.TrimPrefix(o.groupBy, groupByLabelPrefix)
+}
+
+// computePercents computes the percentages of the allocatable.
+func (rs *ResourceStat) computePercents() {
+	rs.RequestsPercent = percentOf(rs.Requests, rs.Allocatable)
+	rs.LimitsPercent = percentOf(rs.Limits, rs.Allocatable)
+	if rs.Usage != nil {
+		percent := percentOf(*rs.Usage, rs.Allocatable)
+		rs.UsagePercent = &percent
+	}
+}
+
+// common returns the value if it is the same for all, or <mixed>.
+func common(values []string) string {
+	for _, v := range values[1:] {
+		if v != values[0] {
+			return mixed
+		}
+	}
+	return values[0]
+}
+
+// sumStats sums up the stats of the nodes, with the percentages computed on
+// the sums. The usage is summed up if any of the nodes reports it, and its
+// percentage is of the allocatable of those nodes only, so that the nodes
+// missing metrics do not dilute it.
+func sumStats(name string, stats []NodeStat) NodeStat {
+	sum := NodeStat{
+		Name:      name,
+		Nodes:     len(stats),
+		Resources: make(map[string]ResourceStat),
+	}
+	// the allocatable of the nodes reporting the usage
+	usageAllocatable := make(map[string]int64)
+	var zones, instanceTypes, versions []string
+	for _, stat := range stats {
+		zones = append(zones, stat.Zone)
+		instanceTypes = append(instanceTypes, stat.InstanceType)
+		versions = append(versions, stat.KubeletVersion)
+		sum.Pods += stat.Pods
+		for res, rs := range stat.Resources {
+			total, ok := sum.Resources[res]
+			if !ok {
+				total.Unit = rs.Unit
+			}
+			total.Allocatable += rs.Allocatable
+			total.Capacity += rs.Capacity
+			total.Requests += rs.Requests
+			total.Limits += rs.Limits
+			if rs.Usage != nil {
+				usage := *rs.Usage
+				if total.Usage != nil {
+					usage += *total.Usage
+				}
+				total.Usage = &usage
+				usageAllocatable[res] += rs.Allocatable
+			}
+			sum.Resources[res] = total
+		}
+	}
+	if len(stats) > 0 {
+		sum.Zone, sum.InstanceType, sum.KubeletVersion = common(zones), common(instanceTypes), common(versions)
+	}
+	for res, rs := range sum.Resources {
+		rs.computePercents()
+		if rs.Usage != nil {
+			percent := percentOf(*rs.Usage, usageAllocatable[res])
+			rs.UsagePercent = &percent
+		}
+		sum.Resources[res] = rs
+	}
+	return sum
+}
+
+// groupStats aggregates the stats of the nodes by the label of --group-by,
+// sorted by the label value.
+func (o *NodeStatOptions) groupStats(stats []NodeStat, nodes map[string]*corev1.Node) []NodeStat {
+	key := o.groupLabel()
+	groups := make(map[string][]NodeStat)
+	for _, stat := range stats {
+		value := utils.OrNone(nodes[stat.Name].Labels[key])
+		groups[value] = append(groups[value], stat)
+	}
+	values := make([]string, 0, len(groups))
+	for value := range groups {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	grouped := make([]NodeStat, 0, len(values))
+	for _, value := range values {
+		group := sumStats(value, groups[value])
+		group.Alerts = o.alerts(group)
+		grouped = append(grouped, group)
+	}
+	return grouped
+}
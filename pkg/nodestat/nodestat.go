@@ -1,9 +1,12 @@
 package nodestat
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sort"
+	"strings"
+	"sync"
 
 	"github.com/knight42/k8s-tools/pkg/tabwriter"
 	"github.com/knight42/k8s-tools/pkg/utils"
@@ -13,9 +16,13 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/pager"
 	metricsapi "k8s.io/metrics/pkg/apis/metrics"
 	metricsv1beta1api "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
@@ -25,22 +32,54 @@ func memoryInMB(bytes int64) int64 {
 	return bytes / (1024 * 1024)
 }
 
+// podResources is the sum of the requests and limits of the pods on a node.
+type podResources struct {
+	requests corev1.ResourceList
+	limits   corev1.ResourceList
+	pods     int
+}
+
+func addResourceList(total, list corev1.ResourceList) {
+	for name, quantity := range list {
+		if value, ok := total[name]; !ok {
+			total[name] = quantity.DeepCopy()
+		} else {
+			value.Add(quantity)
+			total[name] = value
+		}
+	}
+}
+
 type NodeStatOptions struct {
 	configFlags *genericclioptions.ConfigFlags
 
 	namespace     string
 	name          string
 	labelSelector string
+	outputFormat  string
+	resources     []string
+	sortBy        string
+	top           int
+	groupBy       string
+
+	usageThreshold    float64
+	requestsThreshold float64
+	limitsThreshold   float64
+	failAbove         bool
 
 	args             []string
 	enforceNamespace bool
+	clientset        kubernetes.Interface
 	metricsClient    metricsclientset.Interface
 	writer           *tabwriter.Writer
+	printer          printFunc
 }
 
 func NewNodeStatOptions() *NodeStatOptions {
 	return &NodeStatOptions{
 		configFlags: genericclioptions.NewConfigFlags(true),
+		resources:   []string{string(corev1.ResourceCPU), string(corev1.ResourceMemory)},
+		sortBy:      sortByName,
 	}
 }
 
@@ -56,6 +95,15 @@ func NewCmd() *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVarP(&o.labelSelector, "selector", "l", o.labelSelector, "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	cmd.Flags().StringVarP(&o.outputFormat, "output", "o", o.outputFormat, "Output format. One of: json|yaml|csv|wide")
+	cmd.Flags().StringSliceVar(&o.resources, "resources", o.resources, "Resources to show, e.g. cpu,memory,pods,ephemeral-storage,nvidia.com/gpu, or 'all' for every resource allocatable on the nodes.")
+	cmd.Flags().StringVar(&o.sortBy, "sort-by", o.sortBy, "Sort the nodes by name, or by the percentage of <resource>-usage|requests|limits of the allocatable, highest first, e.g. cpu-usage, mem-requests or pods-requests.")
+	cmd.Flags().IntVar(&o.top, "top", o.top, "Only show the first N nodes after sorting, zero means all.")
+	cmd.Flags().StringVar(&o.groupBy, "group-by", o.groupBy, "Aggregate the nodes by a node label given as label:<key>, e.g. label:topology.kubernetes.io/zone.")
+	cmd.Flags().Float64Var(&o.usageThreshold, "usage-threshold", o.usageThreshold, "Flag the nodes whose usage of a resource exceeds this percentage of the allocatable.")
+	cmd.Flags().Float64Var(&o.requestsThreshold, "requests-threshold", o.requestsThreshold, "Flag the nodes whose requests of a resource exceed this percentage of the allocatable.")
+	cmd.Flags().Float64Var(&o.limitsThreshold, "limits-threshold", o.limitsThreshold, "Flag the nodes whose limits of a resource exceed this percentage of the allocatable, e.g. 150 for overcommitted nodes.")
+	cmd.Flags().BoolVar(&o.failAbove, "fail-above", o.failAbove, "Exit with 2 if any node exceeds a threshold.")
 
 	flags := cmd.PersistentFlags()
 	o.configFlags.AddFlags(flags)
@@ -82,6 +130,10 @@ func (o *NodeStatOptions) Complete(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	o.clientset, err = kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return err
+	}
 	o.metricsClient, err = metricsclientset.NewForConfig(restCfg)
 	if err != nil {
 		return err
@@ -91,6 +143,10 @@ func (o *NodeStatOptions) Complete(cmd *cobra.Command, args []string) error {
 		o.name = args[0]
 	}
 
+	o.printer, err = newPrinter(o.outputFormat)
+	if err != nil {
+		return err
+	}
 	o.writer = tabwriter.New(os.Stdout)
 
 	return nil
@@ -107,6 +163,26 @@ func (o *NodeStatOptions) Validate() error {
 	if len(o.args) > 1 {
 		return fmt.Errorf("only one node can be specified")
 	}
+	if err := validResourceNames(o.resources); err != nil {
+		return err
+	}
+	if o.sortBy != sortByName {
+		if err := o.validSortKey(); err != nil {
+			return err
+		}
+	}
+	if len(o.groupBy) != 0 && !validGroupBy(o.groupBy) {
+		return fmt.Errorf("invalid --group-by %q, must be label:<key>", o.groupBy)
+	}
+	if o.top < 0 {
+		return fmt.Errorf("--top must not be negative")
+	}
+	if o.usageThreshold < 0 || o.requestsThreshold < 0 || o.limitsThreshold < 0 {
+		return fmt.Errorf("thresholds must not be negative")
+	}
+	if o.failAbove && !o.hasThreshold() {
+		return fmt.Errorf("--fail-above requires --usage-threshold, --requests-threshold or --limits-threshold")
+	}
 	return nil
 }
 
@@ -115,7 +191,7 @@ func (o *NodeStatOptions) getNodeMetrics() (*metricsapi.NodeMetricsList, error)
 	nml := &metricsapi.NodeMetricsList{}
 
 	if len(o.name) == 0 {
-		ml, err := nmCli.List(metav1.ListOptions{
+		ml, err := nmCli.List(context.TODO(), metav1.ListOptions{
 			LabelSelector: o.labelSelector,
 		})
 		if err != nil {
@@ -128,7 +204,7 @@ func (o *NodeStatOptions) getNodeMetrics() (*metricsapi.NodeMetricsList, error)
 		}
 	} else {
 		var nm metricsapi.NodeMetrics
-		m, err := nmCli.Get(o.name, metav1.GetOptions{})
+		m, err := nmCli.Get(context.TODO(), o.name, metav1.GetOptions{})
 		if err != nil {
 			return nil, err
 		}
@@ -143,16 +219,8 @@ func (o *NodeStatOptions) getNodeMetrics() (*metricsapi.NodeMetricsList, error)
 	return nml, nil
 }
 
-func (o *NodeStatOptions) Run() error {
-	nml, err := o.getNodeMetrics()
-	if err != nil {
-		return err
-	}
-
-	if len(nml.Items) == 0 {
-		return fmt.Errorf("metrics not available yet")
-	}
-
+// getNodes returns the selected nodes by name.
+func (o *NodeStatOptions) getNodes() (map[string]*corev1.Node, error) {
 	args := append([]string{"nodes"}, o.args...)
 	r := o.newBuilder().
 		SingleResourceType().
@@ -161,139 +229,219 @@ func (o *NodeStatOptions) Run() error {
 		Do()
 
 	if err := r.Err(); err != nil {
-		return err
+		return nil, err
 	}
 
-	allocatable := make(map[string]corev1.ResourceList)
-	err = r.Visit(func(info *resource.Info, err error) error {
+	nodes := make(map[string]*corev1.Node)
+	err := r.Visit(func(info *resource.Info, err error) error {
 		if err != nil {
 			return err
 		}
 
 		n := info.Object.(*corev1.Node)
-		allocatable[n.Name] = n.Status.Allocatable
+		nodes[n.Name] = n
 		return nil
 	})
-	if err != nil {
-		return err
-	}
-
-	return o.printResourceUsage(nml.Items, allocatable)
+	return nodes, err
 }
 
-func (o *NodeStatOptions) printResourceUsage(nodeMetrics []metricsapi.NodeMetrics, allocatable map[string]corev1.ResourceList) error {
-	sort.Slice(nodeMetrics, func(i, j int) bool {
-		return nodeMetrics[i].Name < nodeMetrics[j].Name
-	})
-
-	o.writer.SetHeader([]string{"name", "CPU(usage/total)", "requests/limits", "memory(usage/total)", "requests/limits"})
+// getPodResources lists the non-terminal pods of the cluster page by page,
+// or those on the given node, and sums up their requests and limits by node.
+func (o *NodeStatOptions) getPodResources() (map[string]*podResources, error) {
+	selectors := []fields.Selector{
+		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
+		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
+	}
+	if len(o.name) != 0 {
+		selectors = append(selectors, fields.OneTermEqualSelector("spec.nodeName", o.name))
+	}
 
-	maxNodes := len(nodeMetrics)
-	var usage corev1.ResourceList
-	for i, m := range nodeMetrics {
-		err := scheme.Scheme.Convert(&m.Usage, &usage, nil)
-		if err != nil {
-			return err
+	p := pager.New(func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return o.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, opts)
+	})
+	resources := make(map[string]*podResources)
+	err := p.EachListItem(context.TODO(), metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(selectors...).String(),
+	}, func(obj runtime.Object) error {
+		pod := obj.(*corev1.Pod)
+		if len(pod.Spec.NodeName) == 0 {
+			return nil
+		}
+		res, ok := resources[pod.Spec.NodeName]
+		if !ok {
+			res = &podResources{requests: corev1.ResourceList{}, limits: corev1.ResourceList{}}
+			resources[pod.Spec.NodeName] = res
 		}
+		podReqs, podLimits := utils.PodRequestsAndLimits(pod)
+		addResourceList(res.requests, podReqs)
+		addResourceList(res.limits, podLimits)
+		res.pods++
+		return nil
+	})
+	return resources, err
+}
 
-		percent := 100 * float32(i+1) / float32(maxNodes)
-		fmt.Printf("\r\033[2KProgress: %3.2f%% (%d/%d), Node: %s", percent, i+1, maxNodes, m.Name)
-		totalReqsAndLims, err := o.getTotalRequestsAndLimits(m.Name)
+func (o *NodeStatOptions) Run() error {
+	var (
+		wg        sync.WaitGroup
+		nml       *metricsapi.NodeMetricsList
+		nodes     map[string]*corev1.Node
+		resources map[string]*podResources
+		errs      [3]error
+	)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		nml, errs[0] = o.getNodeMetrics()
+	}()
+	go func() {
+		defer wg.Done()
+		nodes, errs[1] = o.getNodes()
+	}()
+	go func() {
+		defer wg.Done()
+		resources, errs[2] = o.getPodResources()
+	}()
+	wg.Wait()
+	for _, err := range errs {
 		if err != nil {
 			return err
 		}
+	}
 
-		cpuReqs := totalReqsAndLims[corev1.ResourceRequestsCPU]
-		memReqs := totalReqsAndLims[corev1.ResourceRequestsMemory]
-		cpuLims := totalReqsAndLims[corev1.ResourceLimitsCPU]
-		memLims := totalReqsAndLims[corev1.ResourceLimitsMemory]
-
-		cpuUsage := usage.Cpu()
-		memUsage := usage.Memory()
-
-		total := allocatable[m.Name]
-		cpuTotal := total.Cpu()
-		memTotal := total.Memory()
-
-		fractionCpuReqs := float64(0)
-		fractionCpuLimits := float64(0)
-		fractionMemReqs := float64(0)
-		fractionMemLimits := float64(0)
-		fractionCpuUsage := float64(0)
-		fractionMemUsage := float64(0)
-
-		if cpuTotal.Value() != 0 {
-			fractionCpuUsage = float64(cpuUsage.MilliValue()) / float64(cpuTotal.MilliValue()) * 100
-			fractionCpuReqs = float64(cpuReqs.MilliValue()) / float64(cpuTotal.MilliValue()) * 100
-			fractionCpuLimits = float64(cpuLims.MilliValue()) / float64(cpuTotal.MilliValue()) * 100
-		}
+	if len(nml.Items) == 0 {
+		return fmt.Errorf("metrics not available yet")
+	}
 
-		if memTotal.Value() != 0 {
-			fractionMemUsage = float64(memUsage.Value()) / float64(memTotal.Value()) * 100
-			fractionMemReqs = float64(memReqs.Value()) / float64(memTotal.Value()) * 100
-			fractionMemLimits = float64(memLims.Value()) / float64(memTotal.Value()) * 100
-		}
+	return o.printResourceUsage(nml.Items, nodes, resources)
+}
 
-		o.writer.Append(
-			m.Name,
-			fmt.Sprintf("%vm(%.1f%%)/%vm", cpuUsage.MilliValue(), fractionCpuUsage, cpuTotal.MilliValue()),
-			fmt.Sprintf("%vm(%.1f%%)/%vm(%.1f%%)", cpuReqs.MilliValue(), fractionCpuReqs, cpuLims.MilliValue(), fractionCpuLimits),
-			fmt.Sprintf("%vMi(%.1f%%)/%vMi", memoryInMB(memUsage.Value()), fractionMemUsage, memoryInMB(memTotal.Value())),
-			fmt.Sprintf("%vMi(%.1f%%)/%vMi(%.1f%%)", memoryInMB(memReqs.Value()), fractionMemReqs, memoryInMB(memLims.Value()), fractionMemLimits),
-		)
+// newNodeStat computes the stat of the given resources the node has from its
+// metrics and the pods on it.
+func newNodeStat(m *metricsapi.NodeMetrics, node *corev1.Node, res *podResources, names []corev1.ResourceName) NodeStat {
+	stat := NodeStat{
+		Name:           node.Name,
+		Zone:           utils.NodeZone(node),
+		InstanceType:   nodeInstanceType(node),
+		KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+		Pods:           res.pods,
+		Resources:      make(map[string]ResourceStat),
 	}
-	fmt.Println()
-	return o.writer.Render()
+	for _, name := range names {
+		if _, ok := node.Status.Allocatable[name]; !ok {
+			continue
+		}
+		var q *apiresource.Quantity
+		if u, ok := m.Usage[name]; ok {
+			q = &u
+		}
+		stat.Resources[string(name)] = newResourceStat(name, node, res, q)
+	}
+	return stat
 }
 
-func (o *NodeStatOptions) getTotalRequestsAndLimits(nodeName string) (corev1.ResourceList, error) {
-	fieldSelector := fields.AndSelectors(
-		fields.OneTermEqualSelector("spec.nodeName", nodeName),
-		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
-		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
-	)
-	r := o.newBuilder().
-		ResourceTypes("pods").
-		FieldSelectorParam(fieldSelector.String()).
-		Do()
+func (o *NodeStatOptions) printResourceUsage(nodeMetrics []metricsapi.NodeMetrics, nodes map[string]*corev1.Node, resources map[string]*podResources) error {
+	sort.Slice(nodeMetrics, func(i, j int) bool {
+		return nodeMetrics[i].Name < nodeMetrics[j].Name
+	})
 
-	if err := r.Err(); err != nil {
-		return nil, err
+	names := o.resourceNames(nodes)
+	var stats []NodeStat
+	for i := range nodeMetrics {
+		m := &nodeMetrics[i]
+		node, ok := nodes[m.Name]
+		if !ok {
+			// the node has been removed since the metrics were collected
+			continue
+		}
+		res, ok := resources[m.Name]
+		if !ok {
+			res = &podResources{}
+		}
+		stat := newNodeStat(m, node, res, names)
+		stat.Alerts = o.alerts(stat)
+		stats = append(stats, stat)
 	}
 
-	totalReqs, totalLimits := corev1.ResourceList{}, corev1.ResourceList{}
-
-	r.Visit(func(info *resource.Info, err error) error {
-		pod := info.Object.(*corev1.Pod)
-		podReqs, podLimits := utils.PodRequestsAndLimits(pod)
-
-		for name, curVal := range podReqs {
-			if totalVal, found := totalReqs[name]; !found {
-				totalReqs[name] = curVal.DeepCopy()
-			} else {
-				totalVal.Add(curVal)
-				totalReqs[name] = totalVal
-			}
+	above := 0
+	for _, stat := range stats {
+		if len(stat.Alerts) != 0 {
+			above++
 		}
+	}
+	// the total is of all the nodes, even those not shown with --top
+	total := sumStats(totalName, stats)
+	total.Alerts = o.alerts(total)
+	if len(o.groupBy) != 0 {
+		stats = o.groupStats(stats, nodes)
+	}
+	o.sortStats(stats)
+	if o.top > 0 && len(stats) > o.top {
+		stats = stats[:o.top]
+	}
 
-		for name, curVal := range podLimits {
-			if totalVal, found := totalLimits[name]; !found {
-				totalLimits[name] = curVal.DeepCopy()
-			} else {
-				totalVal.Add(curVal)
-				totalLimits[name] = totalVal
-			}
+	if err := o.printStats(stats, &total, names); err != nil {
+		return err
+	}
+	if o.failAbove && above > 0 {
+		return &utils.ExitError{
+			Code: exitCodeAboveThreshold,
+			Err:  fmt.Errorf("%d nodes exceed the thresholds", above),
 		}
-		return nil
-	})
+	}
+	return nil
+}
 
-	total := corev1.ResourceList{
-		corev1.ResourceRequestsCPU:    totalReqs[corev1.ResourceCPU],
-		corev1.ResourceRequestsMemory: totalReqs[corev1.ResourceMemory],
+// printStats prints the stats of the nodes or the groups, followed by the
+// total of the cluster if there is more than one node.
+func (o *NodeStatOptions) printStats(stats []NodeStat, total *NodeStat, names []corev1.ResourceName) error {
+	if total.Nodes < 2 {
+		total = nil
+	}
+	if o.printer != nil {
+		return o.printer(os.Stdout, stats, total)
+	}
 
-		corev1.ResourceLimitsCPU:    totalLimits[corev1.ResourceCPU],
-		corev1.ResourceLimitsMemory: totalLimits[corev1.ResourceMemory],
+	header := []string{"name"}
+	if len(o.groupBy) != 0 {
+		header = []string{o.groupLabel(), "nodes"}
+	}
+	for _, name := range names {
+		header = append(header, resourceHeader(name)...)
+	}
+	if o.outputFormat == outputWide {
+		header = append(header, "pods", "zone", "instance type", "kubelet version")
 	}
+	if o.hasThreshold() {
+		header = append(header, "alerts")
+	}
+	o.writer.SetHeader(header)
+	rows := stats
+	if total != nil {
+		rows = append(rows[:len(rows):len(rows)], *total)
+	}
+	for _, stat := range rows {
+		row := []interface{}{stat.Name}
+		if len(o.groupBy) != 0 {
+			row = append(row, stat.Nodes)
+		}
+		for _, name := range names {
+			rs, ok := stat.Resources[string(name)]
+			row = append(row, resourceCells(name, rs, ok)...)
+		}
+		if o.outputFormat == outputWide {
+			row = append(row, stat.Pods, utils.OrNone(stat.Zone), utils.OrNone(stat.InstanceType), stat.KubeletVersion)
+		}
+		if o.hasThreshold() {
+			// the last column, so highlighting it does not break the alignment
+			row = append(row, o.highlight(strings.Join(stat.Alerts, ",")))
+		}
+		o.writer.Append(row...)
+	}
+	return o.writer.Render()
+}
 
-	return total, nil
+// highlight colors the text red if the output is a terminal.
+func (o *NodeStatOptions) highlight(s string) string {
+	return utils.Highlight(os.Stdout, s)
 }
@@ -0,0 +1,234 @@
+package nodestat
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputWide = "wide"
+	outputJSON = "json"
+	outputYAML = "yaml"
+	outputCSV  = "csv"
+)
+
+const (
+	unitMillicores = "millicores"
+	unitBytes      = "bytes"
+	unitCount      = "count"
+)
+
+// NodeStat is the machine readable form of a row printed by kubectl nodestat.
+// Field names are part of the output schema and must stay stable. Nodes is
+// only set for the groups and the total, and Alerts are the resources above
+// the thresholds, like cpu-requests=95.0%.
+type NodeStat struct {
+	Name           string                  `json:"name"`
+	Zone           string                  `json:"zone,omitempty"`
+	InstanceType   string                  `json:"instanceType,omitempty"`
+	KubeletVersion string                  `json:"kubeletVersion,omitempty"`
+	Pods           int                     `json:"pods"`
+	Nodes          int                     `json:"nodes,omitempty"`
+	Resources      map[string]ResourceStat `json:"resources"`
+	Alerts         []string                `json:"alerts,omitempty"`
+}
+
+// ResourceStat is the usage, the allocatable, the capacity and the sum of the
+// requests and limits of the pods of a resource on a node. The quantities are
+// in the unit, and the percentages are of the allocatable. The usage is only
+// known for CPU and memory, and the requests of pods are the number of pods.
+type ResourceStat struct {
+	Unit            string   `json:"unit"`
+	Usage           *int64   `json:"usage,omitempty"`
+	Allocatable     int64    `json:"allocatable"`
+	Capacity        int64    `json:"capacity"`
+	Requests        int64    `json:"requests"`
+	Limits          int64    `json:"limits"`
+	UsagePercent    *float64 `json:"usagePercent,omitempty"`
+	RequestsPercent float64  `json:"requestsPercent"`
+	LimitsPercent   float64  `json:"limitsPercent"`
+}
+
+// NodeStatList is the top level object printed by the json and yaml printers.
+// The items are the groups with --group-by.
+type NodeStatList struct {
+	Items []NodeStat `json:"items"`
+	Total *NodeStat  `json:"total,omitempty"`
+}
+
+func unitOf(name corev1.ResourceName) string {
+	switch {
+	case name == corev1.ResourceCPU:
+		return unitMillicores
+	case name == corev1.ResourceMemory, name == corev1.ResourceEphemeralStorage,
+		strings.HasPrefix(string(name), corev1.ResourceHugePagesPrefix):
+		return unitBytes
+	}
+	return unitCount
+}
+
+// rawValue returns the quantity in the unit of the resource.
+func rawValue(name corev1.ResourceName, q resource.Quantity) int64 {
+	if name == corev1.ResourceCPU {
+		return q.MilliValue()
+	}
+	return q.Value()
+}
+
+func percentOf(value, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(value) / float64(total) * 100
+}
+
+// newResourceStat computes the stat of the resource, usage is nil if unknown.
+func newResourceStat(name corev1.ResourceName, node *corev1.Node, res *podResources, usage *resource.Quantity) ResourceStat {
+	allocatable := rawValue(name, node.Status.Allocatable[name])
+	stat := ResourceStat{
+		Unit:        unitOf(name),
+		Allocatable: allocatable,
+		Capacity:    rawValue(name, node.Status.Capacity[name]),
+		Requests:    rawValue(name, res.requests[name]),
+		Limits:      rawValue(name, res.limits[name]),
+	}
+	if name == corev1.ResourcePods {
+		// every pod takes a slot of the max pods
+		stat.Requests = int64(res.pods)
+	}
+	if usage != nil {
+		value := rawValue(name, *usage)
+		stat.Usage = &value
+	}
+	stat.computePercents()
+	return stat
+}
+
+func nodeInstanceType(node *corev1.Node) string {
+	if typ, ok := node.Labels[corev1.LabelInstanceTypeStable]; ok {
+		return typ
+	}
+	return node.Labels[corev1.LabelInstanceType]
+}
+
+// printFunc prints the stats, total is nil if there is only one node.
+type printFunc func(w io.Writer, stats []NodeStat, total *NodeStat) error
+
+// newPrinter returns the printer for the given output format, or nil if
+// nodes should be printed as a table.
+func newPrinter(format string) (printFunc, error) {
+	switch format {
+	case "", outputWide:
+		return nil, nil
+	case outputJSON:
+		return printJSON, nil
+	case outputYAML:
+		return printYAML, nil
+	case outputCSV:
+		return printCSV, nil
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+func printJSON(w io.Writer, stats []NodeStat, total *NodeStat) error {
+	data, err := json.MarshalIndent(NodeStatList{Items: stats, Total: total}, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func printYAML(w io.Writer, stats []NodeStat, total *NodeStat) error {
+	data, err := yaml.Marshal(NodeStatList{Items: stats, Total: total})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, "---\n", string(data))
+	return err
+}
+
+var csvResourceFields = []string{"unit", "usage", "allocatable", "capacity", "requests", "limits", "usagePercent", "requestsPercent", "limitsPercent"}
+
+func formatPercent(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+// printCSV prints a row per node or group, with the fields of every resource
+// any of the nodes has in columns named like cpu.requests, and a last row
+// named TOTAL for the cluster.
+func printCSV(w io.Writer, stats []NodeStat, total *NodeStat) error {
+	if total != nil {
+		stats = append(stats[:len(stats):len(stats)], *total)
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, stat := range stats {
+		for name := range stat.Resources {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	cw := csv.NewWriter(w)
+	header := []string{"name", "zone", "instanceType", "kubeletVersion", "pods", "nodes"}
+	for _, name := range names {
+		for _, field := range csvResourceFields {
+			header = append(header, name+"."+field)
+		}
+	}
+	header = append(header, "alerts")
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, stat := range stats {
+		var nodes string
+		if stat.Nodes > 0 {
+			nodes = strconv.Itoa(stat.Nodes)
+		}
+		row := []string{stat.Name, stat.Zone, stat.InstanceType, stat.KubeletVersion, strconv.Itoa(stat.Pods), nodes}
+		for _, name := range names {
+			rs, ok := stat.Resources[name]
+			if !ok {
+				row = append(row, make([]string, len(csvResourceFields))...)
+				continue
+			}
+			var usage, usagePercent string
+			if rs.Usage != nil {
+				usage = strconv.FormatInt(*rs.Usage, 10)
+				usagePercent = formatPercent(*rs.UsagePercent)
+			}
+			row = append(row,
+				rs.Unit,
+				usage,
+				strconv.FormatInt(rs.Allocatable, 10),
+				strconv.FormatInt(rs.Capacity, 10),
+				strconv.FormatInt(rs.Requests, 10),
+				strconv.FormatInt(rs.Limits, 10),
+				usagePercent,
+				formatPercent(rs.RequestsPercent),
+				formatPercent(rs.LimitsPercent),
+			)
+		}
+		row = append(row, strings.Join(stat.Alerts, ";"))
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,112 @@
+package nodestat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// allResources selects every resource in the allocatable of the nodes.
+const allResources = "all"
+
+// resourceNames returns the resources given by --resources in order. All the
+// resources of the nodes are CPU, memory and pods first, then the others by name.
+func (o *NodeStatOptions) resourceNames(nodes map[string]*corev1.Node) []corev1.ResourceName {
+	all := false
+	var names []corev1.ResourceName
+	for _, r := range o.resources {
+		if r == allResources {
+			all = true
+			break
+		}
+		names = append(names, corev1.ResourceName(r))
+	}
+	if !all {
+		return names
+	}
+
+	names = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourcePods}
+	seen := map[corev1.ResourceName]bool{
+		corev1.ResourceCPU:    true,
+		corev1.ResourceMemory: true,
+		corev1.ResourcePods:   true,
+	}
+	var others []corev1.ResourceName
+	for _, node := range nodes {
+		for name := range node.Status.Allocatable {
+			if !seen[name] {
+				seen[name] = true
+				others = append(others, name)
+			}
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i] < others[j]
+	})
+	return append(names, others...)
+}
+
+func formatValue(unit string, value int64) string {
+	switch unit {
+	case unitMillicores:
+		return fmt.Sprintf("%dm", value)
+	case unitBytes:
+		return fmt.Sprintf("%dMi", memoryInMB(value))
+	}
+	return fmt.Sprint(value)
+}
+
+// resourceHeader returns the table header of the resource. The usage of CPU
+// and memory are shown along with the requests and limits.
+func resourceHeader(name corev1.ResourceName) []string {
+	switch name {
+	case corev1.ResourceCPU:
+		return []string{"CPU(usage/total)", "requests/limits"}
+	case corev1.ResourceMemory:
+		return []string{"memory(usage/total)", "requests/limits"}
+	}
+	return []string{fmt.Sprintf("%s(requests/total)", name)}
+}
+
+// resourceCells returns the table cells of the resource on a node, which are
+// empty if the node does not have the resource.
+func resourceCells(name corev1.ResourceName, rs ResourceStat, ok bool) []interface{} {
+	header := resourceHeader(name)
+	if !ok {
+		cells := make([]interface{}, len(header))
+		for i := range cells {
+			cells[i] = "-"
+		}
+		return cells
+	}
+
+	value := func(v int64) string {
+		return formatValue(rs.Unit, v)
+	}
+	requests := fmt.Sprintf("%s(%.1f%%)", value(rs.Requests), rs.RequestsPercent)
+	if len(header) == 1 {
+		return []interface{}{fmt.Sprintf("%s/%s", requests, value(rs.Allocatable))}
+	}
+	usage := "<unknown>"
+	if rs.Usage != nil {
+		usage = fmt.Sprintf("%s(%.1f%%)", value(*rs.Usage), *rs.UsagePercent)
+	}
+	return []interface{}{
+		fmt.Sprintf("%s/%s", usage, value(rs.Allocatable)),
+		fmt.Sprintf("%s/%s(%.1f%%)", requests, value(rs.Limits), rs.LimitsPercent),
+	}
+}
+
+func validResourceNames(resources []string) error {
+	if len(resources) == 0 {
+		return fmt.Errorf("--resources must not be empty")
+	}
+	for _, r := range resources {
+		if len(strings.TrimSpace(r)) == 0 {
+			return fmt.Errorf("invalid --resources %q", strings.Join(resources, ","))
+		}
+	}
+	return nil
+}
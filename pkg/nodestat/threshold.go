@@ -0,0 +1,136 @@
+package nodestat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const sortByName = "name"
+
+// exitCodeAboveThreshold is returned by --fail-above, distinct from the exit
+// code 1 of errors.
+const exitCodeAboveThreshold = 2
+
+const (
+	fieldUsage    = "usage"
+	fieldRequests = "requests"
+	fieldLimits   = "limits"
+)
+
+var resourceAliases = map[string]corev1.ResourceName{
+	"mem": corev1.ResourceMemory,
+}
+
+// parseSortKey parses a sort key like cpu-usage or mem-limits into the
+// resource and the field whose percentage the nodes are sorted by.
+func parseSortKey(key string) (corev1.ResourceName, string, error) {
+	idx := strings.LastIndex(key, "-")
+	if idx <= 0 {
+		return "", "", fmt.Errorf("invalid --sort-by %q, must be name or <resource>-usage|requests|limits, e.g. cpu-usage or mem-limits", key)
+	}
+	name, field := key[:idx], key[idx+1:]
+	switch field {
+	case fieldUsage, fieldRequests, fieldLimits:
+	default:
+		return "", "", fmt.Errorf("invalid --sort-by %q, must be name or <resource>-usage|requests|limits, e.g. cpu-usage or mem-limits", key)
+	}
+	if alias, ok := resourceAliases[name]; ok {
+		return alias, field, nil
+	}
+	return corev1.ResourceName(name), field, nil
+}
+
+// validSortKey checks that the resource of --sort-by is shown, otherwise
+// there is nothing to sort the nodes by.
+func (o *NodeStatOptions) validSortKey() error {
+	name, field, err := parseSortKey(o.sortBy)
+	if err != nil {
+		return err
+	}
+	if field == fieldUsage && name != corev1.ResourceCPU && name != corev1.ResourceMemory {
+		return fmt.Errorf("invalid --sort-by %q, the usage is only known for cpu and memory", o.sortBy)
+	}
+	for _, r := range o.resources {
+		if r == allResources || corev1.ResourceName(r) == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("--sort-by %q requires %s in --resources", o.sortBy, name)
+}
+
+// percent returns the percentage of the field, or false if it is unknown.
+func (rs ResourceStat) percent(field string) (float64, bool) {
+	switch field {
+	case fieldUsage:
+		if rs.UsagePercent == nil {
+			return 0, false
+		}
+		return *rs.UsagePercent, true
+	case fieldRequests:
+		return rs.RequestsPercent, true
+	}
+	return rs.LimitsPercent, true
+}
+
+// sortStats sorts the nodes by --sort-by, the highest percentage first. The
+// nodes without the resource come last.
+func (o *NodeStatOptions) sortStats(stats []NodeStat) {
+	if o.sortBy == sortByName {
+		return
+	}
+	name, field, _ := parseSortKey(o.sortBy)
+	key := func(stat NodeStat) float64 {
+		rs, ok := stat.Resources[string(name)]
+		if !ok {
+			return -1
+		}
+		p, ok := rs.percent(field)
+		if !ok {
+			return -1
+		}
+		return p
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return key(stats[i]) > key(stats[j])
+	})
+}
+
+// hasThreshold reports whether any of the thresholds is given.
+func (o *NodeStatOptions) hasThreshold() bool {
+	return o.usageThreshold > 0 || o.requestsThreshold > 0 || o.limitsThreshold > 0
+}
+
+// alerts returns the resources of the node above the thresholds, like cpu-requests=95.0%.
+func (o *NodeStatOptions) alerts(stat NodeStat) []string {
+	thresholds := []struct {
+		field string
+		value float64
+	}{
+		{fieldUsage, o.usageThreshold},
+		{fieldRequests, o.requestsThreshold},
+		{fieldLimits, o.limitsThreshold},
+	}
+
+	names := make([]string, 0, len(stat.Resources))
+	for name := range stat.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var alerts []string
+	for _, name := range names {
+		rs := stat.Resources[name]
+		for _, t := range thresholds {
+			if t.value <= 0 {
+				continue
+			}
+			if p, ok := rs.percent(t.field); ok && p > t.value {
+				alerts = append(alerts, fmt.Sprintf("%s-%s=%.1f%%", name, t.field, p))
+			}
+		}
+	}
+	return alerts
+}
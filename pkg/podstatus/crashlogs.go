@@ -0,0 +1,97 @@
+package podstatus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+const crashLogIndent = "      "
+
+// crashedContainers returns the statuses of containers which have restarted
+// or whose previous instance has terminated.
+func crashedContainers(pod *corev1.Pod) []corev1.ContainerStatus {
+	var statuses []corev1.ContainerStatus
+	all := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, st := range all {
+		if st.RestartCount > 0 || st.LastTerminationState.Terminated != nil {
+			statuses = append(statuses, st)
+		}
+	}
+	return statuses
+}
+
+// printPodsWithCrashLogs prints the pods table, with the tail of the previous
+// logs of every crashed container right under the row of its pod.
+func (o *Options) printPodsWithCrashLogs(pods []*corev1.Pod) error {
+	var buf bytes.Buffer
+	tw := o.newTableWriter(&buf)
+	rowsOfPod := make([]int, len(pods))
+	for i, pod := range pods {
+		rows := append([][]interface{}{o.tableRow(o.podInfo(pod))}, o.containerRows(pod)...)
+		for _, row := range rows {
+			tw.Append(row...)
+		}
+		rowsOfPod[i] = len(rows)
+	}
+	if err := tw.Render(); err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	fmt.Fprintln(o.out, lines[0])
+	lines = lines[1:]
+	for i, pod := range pods {
+		for _, line := range lines[:rowsOfPod[i]] {
+			fmt.Fprintln(o.out, line)
+		}
+		lines = lines[rowsOfPod[i]:]
+		for _, st := range crashedContainers(pod) {
+			o.printCrashLog(pod, st)
+		}
+	}
+	return nil
+}
+
+func (o *Options) printCrashLog(pod *corev1.Pod, st corev1.ContainerStatus) {
+	desc := "<unknown>"
+	if t := st.LastTerminationState.Terminated; t != nil {
+		desc = fmt.Sprintf("%s, exit code %d", utils.OrNone(t.Reason), t.ExitCode)
+		if t.Signal != 0 {
+			desc += fmt.Sprintf(", signal %d", t.Signal)
+		}
+		if !t.FinishedAt.IsZero() {
+			desc += fmt.Sprintf(", finished %s ago (%s)",
+				duration.ShortHumanDuration(time.Since(t.FinishedAt.Time)),
+				t.FinishedAt.UTC().Format(time.RFC3339))
+		}
+	}
+	fmt.Fprintf(o.out, "  > %s: %s, %d restarts\n", st.Name, desc, st.RestartCount)
+
+	tail := o.tailLines
+	data, err := o.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: st.Name,
+		Previous:  true,
+		TailLines: &tail,
+	}).DoRaw(context.TODO())
+	if err != nil {
+		fmt.Fprintf(o.out, "%s<failed to fetch previous logs: %v>\n", crashLogIndent, err)
+		return
+	}
+
+	logs := strings.TrimRight(string(data), "\n")
+	if len(logs) == 0 {
+		fmt.Fprintf(o.out, "%s<no logs>\n", crashLogIndent)
+		return
+	}
+	for _, line := range strings.Split(logs, "\n") {
+		fmt.Fprintf(o.out, "%s%s\n", crashLogIndent, line)
+	}
+}
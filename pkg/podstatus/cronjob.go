@@ -0,0 +1,183 @@
+package podstatus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// maxScheduledMinutes tells the Job name suffixes in minutes from those in
+// seconds, which are above it since 2001 while the minutes stay below it for
+// the next thousand years.
+const maxScheduledMinutes = 1e9
+
+// hasCronJob reports whether any of the targets is a CronJob.
+func (o *Options) hasCronJob() bool {
+	for _, t := range o.targets {
+		if t.cronJob != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchCronJobs refreshes the CronJob targets and the Jobs they own, newest first.
+func (o *Options) fetchCronJobs() error {
+	for _, t := range o.targets {
+		if t.cronJob == nil {
+			continue
+		}
+		cj, err := o.clientset.BatchV1beta1().CronJobs(t.cronJob.Namespace).Get(context.TODO(), t.cronJob.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		// the Jobs carry the labels of the job template, owners are checked below
+		jobList, err := o.clientset.BatchV1().Jobs(cj.Namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(cj.Spec.JobTemplate.Labels).String(),
+		})
+		if err != nil {
+			return err
+		}
+
+		var jobs []*batchv1.Job
+		for i := range jobList.Items {
+			job := &jobList.Items[i]
+			if ref := metav1.GetControllerOf(job); ref != nil && ref.UID == cj.UID {
+				jobs = append(jobs, job)
+			}
+		}
+		sort.SliceStable(jobs, func(i, j int) bool {
+			return jobScheduledTime(jobs[i]).After(jobScheduledTime(jobs[j]))
+		})
+
+		t.cronJob = cj
+		t.jobs = jobs
+		t.panel = cronJobPanel(cj, time.Now())
+	}
+	return nil
+}
+
+// cronJobPanel describes the schedule of the CronJob.
+func cronJobPanel(cj *batchv1beta1.CronJob, now time.Time) []string {
+	suspended := cj.Spec.Suspend != nil && *cj.Spec.Suspend
+
+	lastSchedule := "<none>"
+	if t := cj.Status.LastScheduleTime; t != nil {
+		lastSchedule = fmt.Sprintf("%s ago (%s)", duration.ShortHumanDuration(now.Sub(t.Time)), t.UTC().Format(time.RFC3339))
+	}
+
+	nextRun := "<suspended>"
+	if !suspended {
+		// the controller manager evaluates the schedule in its own time zone,
+		// which is UTC in most clusters
+		sched, err := cron.ParseStandard(cj.Spec.Schedule)
+		if err != nil {
+			nextRun = fmt.Sprintf("<invalid schedule: %v>", err)
+		} else {
+			next := sched.Next(now.UTC())
+			nextRun = fmt.Sprintf("in %s (%s)", duration.ShortHumanDuration(next.Sub(now)), next.Format(time.RFC3339))
+		}
+	}
+
+	return []string{
+		fmt.Sprintf("Schedule: %s, suspended: %t, active jobs: %d", cj.Spec.Schedule, suspended, len(cj.Status.Active)),
+		fmt.Sprintf("Last schedule: %s", lastSchedule),
+		fmt.Sprintf("Next run: %s", nextRun),
+	}
+}
+
+// jobScheduledTime returns the time the Job is scheduled for. The CronJob
+// controller names the Jobs after the scheduled time, in seconds since epoch
+// up to Kubernetes 1.20 and in minutes since then.
+func jobScheduledTime(job *batchv1.Job) time.Time {
+	if idx := strings.LastIndex(job.Name, "-"); idx >= 0 {
+		if n, err := strconv.ParseInt(job.Name[idx+1:], 10, 64); err == nil {
+			if n > maxScheduledMinutes {
+				return time.Unix(n, 0)
+			}
+			return time.Unix(n*60, 0)
+		}
+	}
+	return job.CreationTimestamp.Time
+}
+
+func jobCondition(job *batchv1.Job, typ batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		if cond := &job.Status.Conditions[i]; cond.Type == typ && cond.Status == corev1.ConditionTrue {
+			return cond
+		}
+	}
+	return nil
+}
+
+// jobLine describes the schedule time, status, duration and pod counts of the Job.
+func jobLine(job *batchv1.Job, now time.Time) string {
+	status := "Pending"
+	switch {
+	case jobCondition(job, batchv1.JobComplete) != nil:
+		status = "Complete"
+	case jobCondition(job, batchv1.JobFailed) != nil:
+		status = "Failed"
+		if reason := jobCondition(job, batchv1.JobFailed).Reason; len(reason) != 0 {
+			status += ":" + reason
+		}
+	case job.Status.Active > 0:
+		status = "Running"
+	}
+
+	took := "<none>"
+	if start := job.Status.StartTime; start != nil {
+		end := now
+		if job.Status.CompletionTime != nil {
+			end = job.Status.CompletionTime.Time
+		} else if cond := jobCondition(job, batchv1.JobFailed); cond != nil {
+			end = cond.LastTransitionTime.Time
+		}
+		took = duration.HumanDuration(end.Sub(start.Time))
+	}
+
+	scheduled := jobScheduledTime(job)
+	return fmt.Sprintf("Job: %s  scheduled %s ago (%s)  %s  took %s  succeeded %d, failed %d",
+		job.Name,
+		duration.ShortHumanDuration(now.Sub(scheduled)), scheduled.UTC().Format(time.RFC3339),
+		status, took, job.Status.Succeeded, job.Status.Failed)
+}
+
+// jobHistoryLines renders the pods of the CronJob target nested under the
+// Jobs owning them, newest Job first. Zero width means unlimited.
+func (o *Options) jobHistoryLines(t *target, pods []*corev1.Pod, width int) []string {
+	podsOfJob := make(map[string][]*corev1.Pod)
+	for _, pod := range pods {
+		if ref := metav1.GetControllerOf(pod); ref != nil {
+			podsOfJob[string(ref.UID)] = append(podsOfJob[string(ref.UID)], pod)
+		}
+	}
+	var ordered []*corev1.Pod
+	for _, job := range t.jobs {
+		ordered = append(ordered, podsOfJob[string(job.UID)]...)
+	}
+
+	table, rowsOfPod := o.renderTable(ordered, width)
+	lines := []string{table[0]}
+	table = table[1:]
+	now := time.Now()
+	for _, job := range t.jobs {
+		lines = append(lines, jobLine(job, now))
+		for range podsOfJob[string(job.UID)] {
+			lines = append(lines, table[:rowsOfPod[0]]...)
+			table, rowsOfPod = table[rowsOfPod[0]:], rowsOfPod[1:]
+		}
+	}
+	return lines
+}
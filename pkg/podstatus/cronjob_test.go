@@ -0,0 +1,48 @@
+package podstatus
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestJobScheduledTime(t *testing.T) {
+	created := time.Date(2019, 3, 6, 13, 0, 5, 0, time.UTC)
+
+	testCases := []struct {
+		name   string
+		job    string
+		expect time.Time
+	}{
+		{
+			name:   "seconds since epoch",
+			job:    "sleep-1551877200",
+			expect: time.Date(2019, 3, 6, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "minutes since epoch",
+			job:    "sleep-25864620",
+			expect: time.Date(2019, 3, 6, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "not scheduled by the controller",
+			job:    "sleep-manual",
+			expect: created,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+				Name:              tc.job,
+				CreationTimestamp: metav1.NewTime(created),
+			}}
+			got := jobScheduledTime(job)
+			if !got.Equal(tc.expect) {
+				t.Errorf("unexpected scheduled time\nexpected: %s\n     got: %s", tc.expect, got.UTC())
+			}
+		})
+	}
+}
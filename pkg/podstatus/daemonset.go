@@ -0,0 +1,231 @@
+package podstatus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+// daemonSetTolerations are added to every pod by the DaemonSet controller.
+var daemonSetTolerations = []corev1.Toleration{
+	{Key: corev1.TaintNodeNotReady, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	{Key: corev1.TaintNodeUnreachable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	{Key: corev1.TaintNodeDiskPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodeMemoryPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodePIDPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodeUnschedulable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+}
+
+var nodeSelectorOperators = map[corev1.NodeSelectorOperator]selection.Operator{
+	corev1.NodeSelectorOpIn:           selection.In,
+	corev1.NodeSelectorOpNotIn:        selection.NotIn,
+	corev1.NodeSelectorOpExists:       selection.Exists,
+	corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	corev1.NodeSelectorOpGt:           selection.GreaterThan,
+	corev1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// hasDaemonSet reports whether any of the targets is a DaemonSet.
+func (o *Options) hasDaemonSet() bool {
+	for _, t := range o.targets {
+		if t.daemonSet != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchDaemonSets refreshes the DaemonSet targets, their update revisions and the nodes.
+func (o *Options) fetchDaemonSets() error {
+	var nodes []corev1.Node
+	for _, t := range o.targets {
+		if t.daemonSet == nil {
+			continue
+		}
+		ds, err := o.clientset.AppsV1().DaemonSets(t.daemonSet.Namespace).Get(context.TODO(), t.daemonSet.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		revisions, err := o.controllerRevisions(ds, ds.Spec.Selector)
+		if err != nil {
+			return err
+		}
+		if nodes == nil {
+			nodeList, err := o.clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				return err
+			}
+			nodes = nodeList.Items
+		}
+
+		t.daemonSet = ds
+		t.updateRevision = ""
+		if len(revisions) > 0 {
+			t.updateRevision = revisions[0].Labels[appsv1.DefaultDaemonSetUniqueLabelKey]
+		}
+		t.nodes = nodes
+	}
+	return nil
+}
+
+func matchNodeSelectorTerm(term corev1.NodeSelectorTerm, node *corev1.Node) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	for _, expr := range term.MatchExpressions {
+		op, ok := nodeSelectorOperators[expr.Operator]
+		if !ok {
+			return false
+		}
+		req, err := labels.NewRequirement(expr.Key, op, expr.Values)
+		if err != nil || !req.Matches(labels.Set(node.Labels)) {
+			return false
+		}
+	}
+	for _, field := range term.MatchFields {
+		// metadata.name is the only supported field
+		if field.Key != "metadata.name" {
+			return false
+		}
+		found := false
+		for _, v := range field.Values {
+			if v == node.Name {
+				found = true
+			}
+		}
+		if found != (field.Operator == corev1.NodeSelectorOpIn) {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeSelectorMismatch returns which of the nodeSelector and the required node
+// affinity of the pod excludes the node, or an empty string if neither does.
+func nodeSelectorMismatch(spec *corev1.PodSpec, node *corev1.Node) string {
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return "nodeSelector"
+	}
+
+	if aff := spec.Affinity; aff != nil && aff.NodeAffinity != nil && aff.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		for _, term := range aff.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			if matchNodeSelectorTerm(term, node) {
+				return ""
+			}
+		}
+		return "node affinity"
+	}
+	return ""
+}
+
+// ineligibleReason returns why the pods of the DaemonSet cannot run on the
+// node, or an empty string if they can.
+func ineligibleReason(spec *corev1.PodSpec, node *corev1.Node) string {
+	if reason := nodeSelectorMismatch(spec, node); len(reason) != 0 {
+		return reason
+	}
+
+	tolerations := append(append([]corev1.Toleration{}, spec.Tolerations...), daemonSetTolerations...)
+	if spec.HostNetwork {
+		tolerations = append(tolerations, corev1.Toleration{
+			Key: corev1.TaintNodeNetworkUnavailable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule,
+		})
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range tolerations {
+			if tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return fmt.Sprintf("taint %s", taint.ToString())
+		}
+	}
+	return ""
+}
+
+func isNodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// daemonSetCoverage describes the eligible nodes without a pod, the pods
+// running an outdated revision and the pods on NotReady nodes.
+func daemonSetCoverage(t *target, pods []*corev1.Pod) []string {
+	if t.daemonSet == nil {
+		return nil
+	}
+	podsOnNode := make(map[string][]*corev1.Pod)
+	for _, pod := range pods {
+		if len(pod.Spec.NodeName) != 0 {
+			podsOnNode[pod.Spec.NodeName] = append(podsOnNode[pod.Spec.NodeName], pod)
+		}
+	}
+
+	var (
+		eligible   int
+		covered    int
+		missing    []string
+		ineligible []string
+		notReady   []string
+		outdated   []string
+	)
+	for i := range t.nodes {
+		node := &t.nodes[i]
+		if reason := ineligibleReason(&t.daemonSet.Spec.Template.Spec, node); len(reason) != 0 {
+			ineligible = append(ineligible, fmt.Sprintf("%s (%s)", node.Name, reason))
+			continue
+		}
+		eligible++
+		if len(podsOnNode[node.Name]) == 0 {
+			missing = append(missing, node.Name)
+			continue
+		}
+		covered++
+		if !isNodeReady(node) {
+			for _, pod := range podsOnNode[node.Name] {
+				notReady = append(notReady, fmt.Sprintf("%s (%s)", pod.Name, node.Name))
+			}
+		}
+	}
+	if len(t.updateRevision) != 0 {
+		for _, pod := range pods {
+			if rev := pod.Labels[appsv1.DefaultDaemonSetUniqueLabelKey]; rev != t.updateRevision {
+				outdated = append(outdated, fmt.Sprintf("%s (%s)", pod.Name, utils.OrNone(rev)))
+			}
+		}
+	}
+
+	lines := []string{fmt.Sprintf("Coverage: %d/%d eligible nodes have a pod, %d nodes ineligible", covered, eligible, len(ineligible))}
+	add := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		sort.Strings(items)
+		lines = append(lines, fmt.Sprintf("%s: %s", title, strings.Join(items, ", ")))
+	}
+	add("Missing on", missing)
+	add(fmt.Sprintf("Outdated, update revision %s", t.updateRevision), outdated)
+	add("On NotReady nodes", notReady)
+	add("Ineligible", ineligible)
+	return lines
+}
@@ -0,0 +1,256 @@
+package podstatus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/morikuni/aec"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+const (
+	endpointReady    = "ready"
+	endpointNotReady = "notReady"
+	endpointAbsent   = "absent"
+)
+
+// EndpointInfo is the membership of a pod in the endpoints of the selected Service.
+type EndpointInfo struct {
+	State     string   `json:"state"`
+	Addresses []string `json:"addresses,omitempty"`
+	Ports     []string `json:"ports,omitempty"`
+	Zone      string   `json:"zone,omitempty"`
+}
+
+// endpoint is an address of a Service, together with the pod serving it.
+type endpoint struct {
+	EndpointInfo
+	podName string
+}
+
+// showEndpoints reports whether the endpoint columns are shown, that is
+// whether any of the targets is a Service.
+func (o *Options) showEndpoints() bool {
+	for _, t := range o.targets {
+		if t.service != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func formatPort(name string, port int32, protocol corev1.Protocol) string {
+	s := fmt.Sprintf("%d/%s", port, protocol)
+	if len(name) != 0 {
+		s = name + ":" + s
+	}
+	return s
+}
+
+// fetchEndpoints refreshes the endpoints of every Service target from its
+// EndpointSlices, or from its Endpoints if EndpointSlices are not served or
+// not populated, e.g. when the EndpointSlice controller is disabled.
+func (o *Options) fetchEndpoints() error {
+	for _, t := range o.targets {
+		if t.service == nil {
+			continue
+		}
+		endpoints, found, err := o.listEndpointSlices(t.service)
+		if apierrors.IsNotFound(err) || err == nil && !found {
+			endpoints, err = o.listEndpoints(t.service)
+		}
+		if err != nil {
+			return err
+		}
+		t.endpoints = endpoints
+	}
+	return nil
+}
+
+// listEndpointSlices returns the endpoints in the EndpointSlices of the
+// Service, and whether there is any. The endpoints of a pod in the slices of
+// both address families of a dual-stack Service are merged.
+func (o *Options) listEndpointSlices(svc *corev1.Service) ([]endpoint, bool, error) {
+	sel := labels.SelectorFromSet(labels.Set{discoveryv1beta1.LabelServiceName: svc.Name})
+	slices, err := o.clientset.DiscoveryV1beta1().EndpointSlices(svc.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return nil, false, err
+	}
+
+	var endpoints []endpoint
+	// index of the endpoint of a pod
+	indexOf := make(map[string]int)
+	for _, slice := range slices.Items {
+		var ports []string
+		for _, p := range slice.Ports {
+			var (
+				name     string
+				port     int32
+				protocol = corev1.ProtocolTCP
+			)
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if p.Port != nil {
+				port = *p.Port
+			}
+			if p.Protocol != nil {
+				protocol = *p.Protocol
+			}
+			ports = append(ports, formatPort(name, port, protocol))
+		}
+		for _, ep := range slice.Endpoints {
+			state := endpointReady
+			// a nil condition should be interpreted as ready
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				state = endpointNotReady
+			}
+			var podName string
+			if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
+				podName = ep.TargetRef.Name
+			}
+			if i, ok := indexOf[podName]; ok {
+				merged := &endpoints[i]
+				merged.Addresses = appendUnique(merged.Addresses, ep.Addresses...)
+				merged.Ports = appendUnique(merged.Ports, ports...)
+				if state == endpointNotReady {
+					merged.State = state
+				}
+				continue
+			}
+			if len(podName) != 0 {
+				indexOf[podName] = len(endpoints)
+			}
+			endpoints = append(endpoints, endpoint{
+				EndpointInfo: EndpointInfo{
+					State:     state,
+					Addresses: ep.Addresses,
+					Ports:     ports,
+					Zone:      ep.Topology[corev1.LabelZoneFailureDomainStable],
+				},
+				podName: podName,
+			})
+		}
+	}
+	return endpoints, len(slices.Items) > 0, nil
+}
+
+func appendUnique(values []string, more ...string) []string {
+	for _, v := range more {
+		found := false
+		for _, existing := range values {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (o *Options) listEndpoints(svc *corev1.Service) ([]endpoint, error) {
+	eps, err := o.clientset.CoreV1().Endpoints(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []endpoint
+	for _, subset := range eps.Subsets {
+		var ports []string
+		for _, p := range subset.Ports {
+			ports = append(ports, formatPort(p.Name, p.Port, p.Protocol))
+		}
+		add := func(addrs []corev1.EndpointAddress, state string) {
+			for _, addr := range addrs {
+				var podName string
+				if addr.TargetRef != nil && addr.TargetRef.Kind == "Pod" {
+					podName = addr.TargetRef.Name
+				}
+				endpoints = append(endpoints, endpoint{
+					EndpointInfo: EndpointInfo{
+						State:     state,
+						Addresses: []string{addr.IP},
+						Ports:     ports,
+					},
+					podName: podName,
+				})
+			}
+		}
+		add(subset.Addresses, endpointReady)
+		add(subset.NotReadyAddresses, endpointNotReady)
+	}
+	return endpoints, nil
+}
+
+// podEndpoint returns the membership of the pod in the endpoints of the
+// first Service selecting it, or nil if no Service selects it.
+func (o *Options) podEndpoint(pod *corev1.Pod) *EndpointInfo {
+	for _, t := range o.targets {
+		if t.service == nil || !t.matches(pod) {
+			continue
+		}
+		for i := range t.endpoints {
+			if ep := &t.endpoints[i]; ep.podName == pod.Name {
+				info := ep.EndpointInfo
+				return &info
+			}
+		}
+		return &EndpointInfo{State: endpointAbsent}
+	}
+	return nil
+}
+
+// endpointCells returns the endpoint, ports and zone columns. Ready pods
+// missing from the endpoints are highlighted, as they receive no traffic.
+func (o *Options) endpointCells(info PodInfo) []interface{} {
+	ep := info.Endpoint
+	state, ports, zone := "", "", ""
+	if ep != nil {
+		state, ports, zone = ep.State, utils.OrNone(strings.Join(ep.Ports, ",")), utils.OrNone(ep.Zone)
+	}
+	if ep != nil && state == endpointAbsent && info.TotalCount > 0 && info.ReadyCount == info.TotalCount {
+		state = o.highlight(state + " (pod ready)")
+	} else if utils.IsTerminal(o.out) {
+		// the escapes are as long as those of the highlighted cells, which
+		// keeps the column aligned since they are counted in the width
+		state = aec.DefaultF.Apply(state)
+	}
+	return []interface{}{state, ports, zone}
+}
+
+// staleEndpoints describes the endpoints of the Service whose pods no longer exist.
+func staleEndpoints(t *target, pods []*corev1.Pod) []string {
+	if t.service == nil {
+		return nil
+	}
+	exists := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		exists[pod.Name] = true
+	}
+	var stale []string
+	for _, ep := range t.endpoints {
+		if len(ep.podName) == 0 || exists[ep.podName] {
+			continue
+		}
+		stale = append(stale, fmt.Sprintf("%s (%s, pod %s not found)", strings.Join(ep.Addresses, ","), ep.State, ep.podName))
+	}
+	sort.Strings(stale)
+	if len(stale) == 0 {
+		return nil
+	}
+	return append([]string{"Stale endpoints:"}, stale...)
+}
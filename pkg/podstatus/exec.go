@@ -0,0 +1,284 @@
+package podstatus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/morikuni/aec"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+
+	"github.com/knight42/k8s-tools/pkg/tabwriter"
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+// debugStartTimeout is how long to wait for an ephemeral container to start.
+const debugStartTimeout = 2 * time.Minute
+
+// debugFailureReasons are the waiting reasons of an ephemeral container
+// which will not start without intervention.
+var debugFailureReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"ErrImageNeverPull":          true,
+	"CreateContainerError":       true,
+	"CreateContainerConfigError": true,
+	"RunContainerError":          true,
+}
+
+var prefixColors = []aec.ANSI{
+	aec.CyanF, aec.GreenF, aec.YellowF, aec.MagentaF, aec.BlueF,
+	aec.LightCyanF, aec.LightGreenF, aec.LightYellowF, aec.LightMagentaF, aec.LightBlueF,
+}
+
+// prefixWriter writes every complete line with the prefix. Writers sharing
+// the mutex never interleave within a line.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		w.writeLine(w.buf[:idx])
+		w.buf = w.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, _ = fmt.Fprintf(w.out, "%s%s\n", w.prefix, line)
+}
+
+// Flush writes the last line if it is not terminated by a newline.
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(w.buf)
+		w.buf = nil
+	}
+}
+
+// execResult is the outcome of the command in a pod. The pods which are not
+// running are skipped, which is not a failure.
+type execResult struct {
+	pod       *corev1.Pod
+	container string
+	exitCode  int
+	err       error
+	skipped   string
+}
+
+func (r execResult) String() string {
+	if len(r.skipped) != 0 {
+		return "skipped, pod is " + r.skipped
+	}
+	if r.err != nil {
+		return r.err.Error()
+	}
+	return fmt.Sprintf("exit code %d", r.exitCode)
+}
+
+// execContainer returns the container given by --container, or the first
+// container of the pod.
+func (o *Options) execContainer(pod *corev1.Pod) (string, error) {
+	if len(o.container) == 0 {
+		return pod.Spec.Containers[0].Name, nil
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name == o.container {
+			return c.Name, nil
+		}
+	}
+	return o.container, fmt.Errorf("no container %s", o.container)
+}
+
+// execPods runs the command concurrently in the running pods, at most
+// --max-concurrency at a time, prefixing the output of each pod, then prints
+// the exit codes.
+func (o *Options) execPods(pods []*corev1.Pod) error {
+	if len(pods) == 0 {
+		return fmt.Errorf("no pods selected to run the command in")
+	}
+	width := 0
+	for _, pod := range pods {
+		if len(pod.Name) > width {
+			width = len(pod.Name)
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make([]execResult, len(pods))
+		sem     = make(chan struct{}, o.maxConcurrency)
+	)
+	for i, pod := range pods {
+		container, err := o.execContainer(pod)
+		results[i] = execResult{pod: pod, container: container, err: err}
+		if err != nil {
+			continue
+		}
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			results[i].skipped = newPodInfo(pod).Status
+			continue
+		}
+
+		prefix := fmt.Sprintf("%-*s | ", width, pod.Name)
+		if utils.IsTerminal(o.out) {
+			prefix = prefixColors[i%len(prefixColors)].Apply(prefix)
+		}
+		stdout := &prefixWriter{mu: &mu, out: o.out, prefix: prefix}
+		stderr := &prefixWriter{mu: &mu, out: os.Stderr, prefix: prefix}
+
+		wg.Add(1)
+		go func(r *execResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if len(o.debugImage) != 0 {
+				r.exitCode, r.err = o.debugPod(r.pod, r.container, stdout)
+			} else {
+				r.exitCode, r.err = o.execPod(r.pod, r.container, stdout, stderr)
+			}
+			stdout.Flush()
+			stderr.Flush()
+		}(&results[i])
+	}
+	wg.Wait()
+
+	failed := 0
+	tw := tabwriter.New(o.out)
+	tw.SetHeader([]string{"pod", "container", "result"})
+	for _, r := range results {
+		result := r.String()
+		if len(r.skipped) == 0 && (r.err != nil || r.exitCode != 0) {
+			failed++
+			result = o.highlight(result)
+		}
+		tw.Append(r.pod.Name, r.container, result)
+	}
+	fmt.Fprintln(o.out)
+	if err := tw.Render(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return &utils.ExitError{
+			Code: 1,
+			Err:  fmt.Errorf("command failed in %d of %d pods", failed, len(pods)),
+		}
+	}
+	return nil
+}
+
+// execPod runs the command in the container through the exec subresource.
+func (o *Options) execPod(pod *corev1.Pod, container string, stdout, stderr io.Writer) (int, error) {
+	req := o.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   o.command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(o.restConfig, "POST", req.URL())
+	if err != nil {
+		return 0, err
+	}
+	err = executor.Stream(remotecommand.StreamOptions{Stdout: stdout, Stderr: stderr})
+	if exitErr, ok := err.(exec.ExitError); ok && exitErr.Exited() {
+		return exitErr.ExitStatus(), nil
+	}
+	return 0, err
+}
+
+// debugPod runs the command in a new ephemeral container of --debug-image
+// targeting the container, follows its logs and returns its exit code.
+func (o *Options) debugPod(pod *corev1.Pod, container string, out io.Writer) (int, error) {
+	pods := o.clientset.CoreV1().Pods(pod.Namespace)
+	ecs, err := pods.GetEphemeralContainers(context.TODO(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("ephemeral containers are not available: %v", err)
+	}
+	name := fmt.Sprintf("debugger-%s", utilrand.String(5))
+	ecs.EphemeralContainers = append(ecs.EphemeralContainers, corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    o.debugImage,
+			Command:                  o.command,
+			ImagePullPolicy:          corev1.PullIfNotPresent,
+			TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		},
+		TargetContainerName: container,
+	})
+	if _, err := pods.UpdateEphemeralContainers(context.TODO(), pod.Name, ecs, metav1.UpdateOptions{}); err != nil {
+		return 0, fmt.Errorf("add ephemeral container: %v", err)
+	}
+
+	// state polls the state of the ephemeral container until done returns true
+	state := func(done func(corev1.ContainerState) bool) (corev1.ContainerState, error) {
+		var st corev1.ContainerState
+		err := wait.PollImmediate(time.Second, debugStartTimeout, func() (bool, error) {
+			p, err := pods.Get(context.TODO(), pod.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			for _, s := range p.Status.EphemeralContainerStatuses {
+				if s.Name != name {
+					continue
+				}
+				st = s.State
+				if w := st.Waiting; w != nil && debugFailureReasons[w.Reason] {
+					return false, fmt.Errorf("ephemeral container %s: %s", name, w.Reason)
+				}
+				return done(st), nil
+			}
+			return false, nil
+		})
+		if err == wait.ErrWaitTimeout {
+			err = fmt.Errorf("timed out waiting for ephemeral container %s", name)
+		}
+		return st, err
+	}
+
+	if _, err := state(func(st corev1.ContainerState) bool { return st.Waiting == nil }); err != nil {
+		return 0, err
+	}
+	logs, err := pods.GetLogs(pod.Name, &corev1.PodLogOptions{Container: name, Follow: true}).Stream(context.TODO())
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(out, logs)
+	logs.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	st, err := state(func(st corev1.ContainerState) bool { return st.Terminated != nil })
+	if err != nil {
+		return 0, err
+	}
+	return int(st.Terminated.ExitCode), nil
+}
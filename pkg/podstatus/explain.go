@@ -0,0 +1,311 @@
+package podstatus
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/knight42/k8s-tools/pkg/tabwriter"
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+var nodesAvailableRe = regexp.MustCompile(`^(\d+)/(\d+) nodes are available: (.*)$`)
+
+// getPodEvents returns the events of the pod, oldest first.
+func (o *Options) getPodEvents(pod *corev1.Pod) ([]corev1.Event, error) {
+	return o.getEvents(pod.Namespace, pod.Name, pod.UID)
+}
+
+// getEvents returns the events of the object, oldest first.
+func (o *Options) getEvents(namespace, name string, uid types.UID) ([]corev1.Event, error) {
+	evtSelector := fields.AndSelectors(
+		fields.OneTermEqualSelector("involvedObject.name", name),
+		fields.OneTermEqualSelector("involvedObject.namespace", namespace),
+		fields.OneTermEqualSelector("involvedObject.uid", string(uid)),
+	)
+	r := newBuilder(o.configFlags).
+		NamespaceParam(namespace).DefaultNamespace().
+		FieldSelectorParam(evtSelector.String()).
+		SingleResourceType().
+		ResourceTypes("events").
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []corev1.Event
+	err := r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		evt, ok := info.Object.(*corev1.Event)
+		if !ok {
+			return fmt.Errorf("not event: %s", info.Object)
+		}
+		events = append(events, *evt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+	return events, nil
+}
+
+// isHealthy reports whether the pod has completed or is ready.
+func isHealthy(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded {
+		return true
+	}
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// lastEvent returns the message of the most recent event with one of the given reasons.
+func lastEvent(events []corev1.Event, reasons ...string) (string, bool) {
+	for i := len(events) - 1; i >= 0; i-- {
+		for _, reason := range reasons {
+			if events[i].Reason == reason {
+				return strings.TrimSpace(events[i].Message), true
+			}
+		}
+	}
+	return "", false
+}
+
+func getCondition(pod *corev1.Pod, condType corev1.PodConditionType) *corev1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == condType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// splitSchedulingReasons splits the reasons of a FailedScheduling message like
+// `1 node(s) had taint {a: b}, that the pod didn't tolerate, 2 Insufficient cpu.`
+func splitSchedulingReasons(s string) []string {
+	s = strings.TrimSuffix(strings.TrimSpace(s), ".")
+	var (
+		reasons []string
+		depth   int
+		start   int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+		case ',':
+			rest := strings.TrimLeft(s[i+1:], " ")
+			if depth == 0 && len(rest) > 0 && rest[0] >= '0' && rest[0] <= '9' {
+				reasons = append(reasons, strings.TrimSpace(s[start:i]))
+				start = len(s) - len(rest)
+			}
+		}
+	}
+	return append(reasons, strings.TrimSpace(s[start:]))
+}
+
+// summarizeSchedulingReason turns a single FailedScheduling reason into a short phrase.
+func summarizeSchedulingReason(reason string) string {
+	count := ""
+	if i := strings.IndexByte(reason, ' '); i > 0 && reason[0] >= '0' && reason[0] <= '9' {
+		count, reason = reason[:i], reason[i+1:]
+	}
+
+	var desc string
+	lower := strings.ToLower(reason)
+	switch {
+	case strings.HasPrefix(reason, "Insufficient "):
+		desc = "insufficient " + strings.TrimPrefix(reason, "Insufficient ")
+	case strings.Contains(lower, "taint"):
+		desc = "untolerated taint"
+		if i, j := strings.IndexByte(reason, '{'), strings.IndexByte(reason, '}'); i >= 0 && j > i {
+			desc += " " + reason[i:j+1]
+		}
+	case strings.Contains(lower, "persistentvolumeclaim"), strings.Contains(lower, "volume"):
+		desc = "volume binding: " + reason
+	case strings.Contains(lower, "didn't match pod affinity"),
+		strings.Contains(lower, "didn't match pod anti-affinity"),
+		strings.Contains(lower, "pod affinity/anti-affinity"):
+		desc = "pod (anti-)affinity mismatch"
+	case strings.Contains(lower, "node affinity"), strings.Contains(lower, "node selector"):
+		desc = "node affinity/selector mismatch"
+	case strings.Contains(lower, "unschedulable"):
+		desc = "node unschedulable"
+	default:
+		desc = reason
+	}
+
+	if len(count) == 0 {
+		return desc
+	}
+	return fmt.Sprintf("%s on %s node(s)", desc, count)
+}
+
+func explainScheduling(pod *corev1.Pod, events []corev1.Event) string {
+	msg, ok := lastEvent(events, "FailedScheduling")
+	if !ok {
+		if cond := getCondition(pod, corev1.PodScheduled); cond != nil && cond.Status == corev1.ConditionFalse && len(cond.Message) > 0 {
+			msg = cond.Message
+		} else {
+			return "waiting to be scheduled"
+		}
+	}
+
+	m := nodesAvailableRe.FindStringSubmatch(msg)
+	if m == nil {
+		if strings.Contains(msg, "unbound immediate PersistentVolumeClaims") {
+			return "unschedulable: PersistentVolumeClaims are not bound yet"
+		}
+		return "unschedulable: " + strings.TrimSuffix(msg, ".")
+	}
+	var phrases []string
+	for _, reason := range splitSchedulingReasons(m[3]) {
+		phrases = append(phrases, summarizeSchedulingReason(reason))
+	}
+	return fmt.Sprintf("unschedulable (%s/%s nodes available): %s", m[1], m[2], strings.Join(phrases, ", "))
+}
+
+func explainWaiting(prefix string, st corev1.ContainerStatus, events []corev1.Event) (string, bool) {
+	w := st.State.Waiting
+	if w == nil {
+		return "", false
+	}
+	switch w.Reason {
+	case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull":
+		msg := w.Message
+		if evtMsg, ok := lastEvent(events, "Failed"); ok && strings.Contains(evtMsg, "image") {
+			msg = evtMsg
+		}
+		return fmt.Sprintf("%scontainer %s cannot pull image %s: %s", prefix, st.Name, st.Image, utils.OrNone(msg)), true
+	case "CrashLoopBackOff":
+		last := "unknown reason"
+		if t := st.LastTerminationState.Terminated; t != nil {
+			last = fmt.Sprintf("%s, exit code %d", utils.OrNone(t.Reason), t.ExitCode)
+		}
+		return fmt.Sprintf("%scontainer %s is crash looping (%d restarts), last terminated: %s", prefix, st.Name, st.RestartCount, last), true
+	case "CreateContainerConfigError", "CreateContainerError", "RunContainerError":
+		return fmt.Sprintf("%scontainer %s cannot be started: %s", prefix, st.Name, utils.OrNone(w.Message)), true
+	case "ContainerCreating", "PodInitializing":
+		if msg, ok := lastEvent(events, "FailedMount", "FailedAttachVolume"); ok {
+			return "volume mount failed: " + msg, true
+		}
+		if msg, ok := lastEvent(events, "FailedCreatePodSandBox"); ok {
+			return "sandbox creation failed: " + msg, true
+		}
+		return "", false
+	}
+	if len(w.Reason) != 0 {
+		return fmt.Sprintf("%scontainer %s is waiting: %s %s", prefix, st.Name, w.Reason, w.Message), true
+	}
+	return "", false
+}
+
+// explainPod returns one concise human readable reason why the pod is not
+// healthy, or an empty string if it is.
+func explainPod(pod *corev1.Pod, events []corev1.Event) string {
+	if isHealthy(pod) {
+		return ""
+	}
+	if pod.DeletionTimestamp != nil {
+		return "being deleted"
+	}
+	if pod.Status.Phase == corev1.PodFailed {
+		return fmt.Sprintf("failed: %s %s", utils.OrNone(pod.Status.Reason), pod.Status.Message)
+	}
+	if len(pod.Spec.NodeName) == 0 {
+		return explainScheduling(pod, events)
+	}
+
+	for _, st := range pod.Status.InitContainerStatuses {
+		if t := st.State.Terminated; t != nil && t.ExitCode != 0 {
+			return fmt.Sprintf("init container %s failed: %s, exit code %d", st.Name, utils.OrNone(t.Reason), t.ExitCode)
+		}
+		if msg, ok := explainWaiting("init ", st, events); ok {
+			return msg
+		}
+	}
+	for _, st := range pod.Status.ContainerStatuses {
+		if msg, ok := explainWaiting("", st, events); ok {
+			return msg
+		}
+	}
+
+	if msg, ok := lastEvent(events, "FailedMount", "FailedAttachVolume"); ok && pod.Status.Phase == corev1.PodPending {
+		return "volume mount failed: " + msg
+	}
+
+	// running, but not ready
+	var unready []string
+	for _, st := range pod.Status.ContainerStatuses {
+		if !st.Ready {
+			unready = append(unready, st.Name)
+		}
+	}
+	if msg, ok := lastEvent(events, "Unhealthy"); ok && len(unready) > 0 {
+		return fmt.Sprintf("container %s not ready: %s", strings.Join(unready, ","), msg)
+	}
+	for _, gate := range pod.Spec.ReadinessGates {
+		cond := getCondition(pod, gate.ConditionType)
+		if cond == nil || cond.Status != corev1.ConditionTrue {
+			return fmt.Sprintf("readiness gate %s is not satisfied", gate.ConditionType)
+		}
+	}
+	if len(unready) > 0 {
+		return fmt.Sprintf("container %s not ready", strings.Join(unready, ","))
+	}
+	if cond := getCondition(pod, corev1.PodReady); cond != nil && len(cond.Message) != 0 {
+		return cond.Message
+	}
+	return fmt.Sprintf("pod is %s", utils.OrNone(string(pod.Status.Phase)))
+}
+
+// explainPods diagnoses every unhealthy pod.
+func (o *Options) explainPods(pods []*corev1.Pod) error {
+	o.explanations = make(map[string]string)
+	for _, pod := range pods {
+		if isHealthy(pod) {
+			continue
+		}
+		events, err := o.getPodEvents(pod)
+		if err != nil {
+			return err
+		}
+		o.explanations[string(pod.UID)] = explainPod(pod, events)
+	}
+	return nil
+}
+
+func (o *Options) printExplanations(pods []*corev1.Pod) error {
+	if len(o.explanations) == 0 {
+		return nil
+	}
+	tw := tabwriter.New(o.out)
+	tw.SetHeader([]string{"name", "explanation"})
+	for _, pod := range pods {
+		if msg, ok := o.explanations[string(pod.UID)]; ok {
+			tw.Append(pod.Name, msg)
+		}
+	}
+	fmt.Fprintln(o.out)
+	return tw.Render()
+}
@@ -0,0 +1,183 @@
+package podstatus
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	sortByName     = "name"
+	sortByAge      = "age"
+	sortByRestarts = "restarts"
+	sortByStatus   = "status"
+	sortByNode     = "node"
+)
+
+var sortKeys = []string{sortByName, sortByAge, sortByRestarts, sortByStatus, sortByNode}
+
+func validSortKey(key string) bool {
+	for _, k := range sortKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesStatus reports whether the status is selected by --status. Statuses
+// prefixed with "!" are excluded, the others are alternatives.
+func (o *Options) matchesStatus(status string) bool {
+	included, hasIncluded := false, false
+	for _, s := range o.statusFilters {
+		if strings.HasPrefix(s, "!") {
+			if strings.EqualFold(s[1:], status) {
+				return false
+			}
+			continue
+		}
+		hasIncluded = true
+		if strings.EqualFold(s, status) {
+			included = true
+		}
+	}
+	return included || !hasIncluded
+}
+
+// matchesFilters reports whether the pod is selected by the filters, which
+// are evaluated against the status shown in the table rather than the phase.
+func (o *Options) matchesFilters(pod *corev1.Pod) bool {
+	info := newPodInfo(pod)
+	if !o.matchesStatus(info.Status) {
+		return false
+	}
+	if o.notReady && info.ReadyCount == info.TotalCount && info.Status == string(corev1.PodRunning) {
+		return false
+	}
+	if o.restartsGt >= 0 && info.Restarts <= o.restartsGt {
+		return false
+	}
+	if len(o.nodes) != 0 {
+		found := false
+		for _, node := range o.nodes {
+			if node == info.Node {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func podAge(pod *corev1.Pod) time.Time {
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time
+	}
+	return pod.CreationTimestamp.Time
+}
+
+// selectPods returns the pods matching the filters in the order asked for by --sort-by.
+func (o *Options) selectPods(pods []*corev1.Pod) []*corev1.Pod {
+	selected := make([]*corev1.Pod, 0, len(pods))
+	infos := make(map[*corev1.Pod]PodInfo, len(pods))
+	for _, pod := range pods {
+		if o.matchesFilters(pod) {
+			selected = append(selected, pod)
+			infos[pod] = newPodInfo(pod)
+		}
+	}
+
+	byName := func(i, j int) bool {
+		a, b := selected[i], selected[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		// pods of a StatefulSet are in ordinal order, web-2 before web-10
+		prefixA, ordinalA, okA := podOrdinal(a)
+		prefixB, ordinalB, okB := podOrdinal(b)
+		if okA && okB && prefixA == prefixB {
+			return ordinalA < ordinalB
+		}
+		return a.Name < b.Name
+	}
+	var less func(i, j int) bool
+	switch o.sortBy {
+	case sortByAge:
+		// youngest first, the same order as the age column
+		less = func(i, j int) bool {
+			a, b := podAge(selected[i]), podAge(selected[j])
+			if !a.Equal(b) {
+				return a.After(b)
+			}
+			return byName(i, j)
+		}
+	case sortByRestarts:
+		// the most restarted first
+		less = func(i, j int) bool {
+			a, b := infos[selected[i]].Restarts, infos[selected[j]].Restarts
+			if a != b {
+				return a > b
+			}
+			return byName(i, j)
+		}
+	case sortByStatus:
+		less = func(i, j int) bool {
+			a, b := infos[selected[i]].Status, infos[selected[j]].Status
+			if a != b {
+				return a < b
+			}
+			return byName(i, j)
+		}
+	case sortByNode:
+		less = func(i, j int) bool {
+			a, b := infos[selected[i]].Node, infos[selected[j]].Node
+			if a != b {
+				return a < b
+			}
+			return byName(i, j)
+		}
+	default:
+		less = byName
+	}
+	sort.Slice(selected, less)
+	return selected
+}
+
+// statusFooter counts the shown pods by status, e.g.
+// "3 pods: 2 Running, 1 CrashLoopBackOff", or "1 of 3 pods: ..." if some are filtered out.
+func statusFooter(shown []*corev1.Pod, total int) string {
+	counts := make(map[string]int)
+	for _, pod := range shown {
+		counts[newPodInfo(pod).Status]++
+	}
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		return a < b
+	})
+
+	footer := fmt.Sprintf("%d pods", total)
+	if len(shown) != total {
+		footer = fmt.Sprintf("%d of %d pods", len(shown), total)
+	}
+	parts := make([]string, len(statuses))
+	for i, status := range statuses {
+		parts[i] = fmt.Sprintf("%d %s", counts[status], status)
+	}
+	if len(parts) > 0 {
+		footer += ": " + strings.Join(parts, ", ")
+	}
+	return footer
+}
@@ -2,9 +2,7 @@ package podstatus
 
 import (
 	"fmt"
-	"io"
 
-	"github.com/morikuni/aec"
 	appsv1 "k8s.io/api/apps/v1"
 	appsv1beta1 "k8s.io/api/apps/v1beta1"
 	appsv1beta2 "k8s.io/api/apps/v1beta2"
@@ -22,16 +20,13 @@ import (
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/kubernetes/scheme"
-)
 
-func clearLine(out io.Writer) {
-	eraseMode := aec.EraseModes.All
-	cl := aec.EraseLine(eraseMode)
-	_, _ = fmt.Fprint(out, cl)
-}
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
 
-func cursorUp(out io.Writer, l uint) {
-	_, _ = fmt.Fprint(out, aec.Up(l))
+// highlight colors the text red if the output is a terminal.
+func (o *Options) highlight(s string) string {
+	return utils.Highlight(o.out, s)
 }
 
 func isHPA(obj runtime.Object) bool {
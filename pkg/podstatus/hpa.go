@@ -0,0 +1,176 @@
+package podstatus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// maxHPAEvents is the number of the most recent events shown in the HPA panel.
+const maxHPAEvents = 5
+
+var hpaConditionTypes = []autoscalingv2beta2.HorizontalPodAutoscalerConditionType{
+	autoscalingv2beta2.AbleToScale,
+	autoscalingv2beta2.ScalingActive,
+	autoscalingv2beta2.ScalingLimited,
+}
+
+// hasHPA reports whether any of the targets is given as a HorizontalPodAutoscaler.
+func (o *Options) hasHPA() bool {
+	for _, t := range o.targets {
+		if len(t.hpaName) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchHPAs refreshes the panels of the targets given as HorizontalPodAutoscalers.
+func (o *Options) fetchHPAs() error {
+	for _, t := range o.targets {
+		if len(t.hpaName) == 0 {
+			continue
+		}
+		hpa, err := o.clientset.AutoscalingV2beta2().HorizontalPodAutoscalers(t.namespace).Get(context.TODO(), t.hpaName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		events, err := o.getEvents(hpa.Namespace, hpa.Name, hpa.UID)
+		if err != nil {
+			return err
+		}
+		panel := hpaPanel(hpa)
+		if len(events) > maxHPAEvents {
+			events = events[len(events)-maxHPAEvents:]
+		}
+		if len(events) > 0 {
+			panel = append(panel, "  Events:")
+		}
+		for _, evt := range events {
+			panel = append(panel, fmt.Sprintf("    %s ago  %s  %s",
+				duration.ShortHumanDuration(time.Since(evt.LastTimestamp.Time)), evt.Reason, evt.Message))
+		}
+		t.panel = panel
+	}
+	return nil
+}
+
+// hpaPanel describes the replicas, metrics and conditions of the HPA.
+func hpaPanel(hpa *autoscalingv2beta2.HorizontalPodAutoscaler) []string {
+	minReplicas := int32(1)
+	if hpa.Spec.MinReplicas != nil {
+		minReplicas = *hpa.Spec.MinReplicas
+	}
+	lines := []string{
+		fmt.Sprintf("HorizontalPodAutoscaler: %s/%s", hpa.Namespace, hpa.Name),
+		fmt.Sprintf("  Replicas: current %d, desired %d (min %d, max %d)",
+			hpa.Status.CurrentReplicas, hpa.Status.DesiredReplicas, minReplicas, hpa.Spec.MaxReplicas),
+	}
+
+	if len(hpa.Spec.Metrics) > 0 {
+		lines = append(lines, "  Metrics: (current / target)")
+	}
+	for i, spec := range hpa.Spec.Metrics {
+		// the current metrics are reported in the same order as the spec
+		var current *autoscalingv2beta2.MetricStatus
+		if i < len(hpa.Status.CurrentMetrics) {
+			current = &hpa.Status.CurrentMetrics[i]
+		}
+		lines = append(lines, "    "+describeMetric(spec, current))
+	}
+
+	var conditions []string
+	for _, typ := range hpaConditionTypes {
+		for _, cond := range hpa.Status.Conditions {
+			if cond.Type != typ {
+				continue
+			}
+			conditions = append(conditions, fmt.Sprintf("    %s=%s (%s): %s", cond.Type, cond.Status, cond.Reason, cond.Message))
+		}
+	}
+	if len(conditions) > 0 {
+		lines = append(lines, "  Conditions:")
+		lines = append(lines, conditions...)
+	}
+	return lines
+}
+
+func formatMetricTarget(t autoscalingv2beta2.MetricTarget) string {
+	switch {
+	case t.AverageUtilization != nil:
+		return fmt.Sprintf("%d%%", *t.AverageUtilization)
+	case t.AverageValue != nil:
+		return t.AverageValue.String() + " (avg)"
+	case t.Value != nil:
+		return t.Value.String()
+	}
+	return "<unset>"
+}
+
+func formatMetricValue(v *autoscalingv2beta2.MetricValueStatus) string {
+	switch {
+	case v == nil:
+	case v.AverageUtilization != nil:
+		return fmt.Sprintf("%d%%", *v.AverageUtilization)
+	case v.AverageValue != nil:
+		return v.AverageValue.String() + " (avg)"
+	case v.Value != nil:
+		return v.Value.String()
+	}
+	return "<unknown>"
+}
+
+// describeMetric returns the name, current and target value of the metric.
+func describeMetric(spec autoscalingv2beta2.MetricSpec, status *autoscalingv2beta2.MetricStatus) string {
+	var (
+		name    string
+		target  string
+		current *autoscalingv2beta2.MetricValueStatus
+	)
+	switch spec.Type {
+	case autoscalingv2beta2.ResourceMetricSourceType:
+		if spec.Resource == nil {
+			break
+		}
+		name = fmt.Sprintf("resource %s", spec.Resource.Name)
+		target = formatMetricTarget(spec.Resource.Target)
+		if status != nil && status.Resource != nil {
+			current = &status.Resource.Current
+		}
+	case autoscalingv2beta2.PodsMetricSourceType:
+		if spec.Pods == nil {
+			break
+		}
+		name = fmt.Sprintf("pods %s", spec.Pods.Metric.Name)
+		target = formatMetricTarget(spec.Pods.Target)
+		if status != nil && status.Pods != nil {
+			current = &status.Pods.Current
+		}
+	case autoscalingv2beta2.ObjectMetricSourceType:
+		if spec.Object == nil {
+			break
+		}
+		name = fmt.Sprintf("object %s/%s %s", spec.Object.DescribedObject.Kind, spec.Object.DescribedObject.Name, spec.Object.Metric.Name)
+		target = formatMetricTarget(spec.Object.Target)
+		if status != nil && status.Object != nil {
+			current = &status.Object.Current
+		}
+	case autoscalingv2beta2.ExternalMetricSourceType:
+		if spec.External == nil {
+			break
+		}
+		name = fmt.Sprintf("external %s", spec.External.Metric.Name)
+		target = formatMetricTarget(spec.External.Target)
+		if status != nil && status.External != nil {
+			current = &status.External.Current
+		}
+	}
+	if len(name) == 0 {
+		return fmt.Sprintf("%s: <unknown>", spec.Type)
+	}
+	return fmt.Sprintf("%s: %s / %s", name, formatMetricValue(current), target)
+}
@@ -0,0 +1,255 @@
+package podstatus
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+// logMergeDelay is how long the lines are held in follow mode, so that the
+// lines of different streams arriving out of order are printed in order.
+const logMergeDelay = time.Second
+
+type logLine struct {
+	time     time.Time
+	received time.Time
+	prefix   string
+	color    int
+	text     string
+}
+
+// logTailer streams the logs of the containers of the pods it observes, and
+// prints the lines merged by their timestamps.
+type logTailer struct {
+	o      *Options
+	follow bool
+
+	mu      sync.Mutex
+	lines   []logLine
+	width   int
+	colors  map[string]int
+	streams map[string]map[string]context.CancelFunc
+	// limits the streams open at the same time without follow
+	sem chan struct{}
+
+	wg   sync.WaitGroup
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newLogTailer(o *Options, follow bool) *logTailer {
+	t := &logTailer{
+		o:       o,
+		follow:  follow,
+		colors:  make(map[string]int),
+		streams: make(map[string]map[string]context.CancelFunc),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if !follow {
+		t.sem = make(chan struct{}, o.maxConcurrency)
+		close(t.done)
+		return t
+	}
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(logMergeDelay / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				t.flush(now.Add(-logMergeDelay))
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// Close waits for the streams to end, which are stopped first in follow
+// mode, and prints the remaining lines.
+func (t *logTailer) Close() {
+	t.mu.Lock()
+	if t.follow {
+		for _, streams := range t.streams {
+			for _, cancel := range streams {
+				cancel()
+			}
+		}
+	}
+	t.mu.Unlock()
+	t.wg.Wait()
+	close(t.stop)
+	<-t.done
+	t.flush(time.Now())
+}
+
+// logContainers returns the containers given by --container, or all the
+// containers of the pod.
+func (o *Options) logContainers(pod *corev1.Pod) []corev1.ContainerStatus {
+	var statuses []corev1.ContainerStatus
+	for _, st := range pod.Status.ContainerStatuses {
+		if len(o.container) == 0 || st.Name == o.container {
+			statuses = append(statuses, st)
+		}
+	}
+	return statuses
+}
+
+// observe starts streaming the containers of the pod which have started
+// since the last time, and stops the streams of deleted pods. Only the tail
+// of the logs of the containers running when the pod is listed is printed.
+func (t *logTailer) observe(pod *corev1.Pod, deleted, listed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	uid := string(pod.UID)
+	if deleted {
+		for _, cancel := range t.streams[uid] {
+			cancel()
+		}
+		delete(t.streams, uid)
+		return
+	}
+	if !t.o.matchesFilters(pod) {
+		return
+	}
+
+	streams, ok := t.streams[uid]
+	if !ok {
+		streams = make(map[string]context.CancelFunc)
+		t.streams[uid] = streams
+	}
+	if _, ok := t.colors[uid]; !ok {
+		t.colors[uid] = len(t.colors)
+	}
+	// the tail is only for the logs written before we started
+	fresh := listed && len(streams) == 0
+	containers := t.o.logContainers(pod)
+	for _, st := range containers {
+		if len(st.ContainerID) == 0 || st.State.Waiting != nil {
+			continue
+		}
+		if _, ok := streams[st.ContainerID]; ok {
+			continue
+		}
+
+		opts := &corev1.PodLogOptions{
+			Container:  st.Name,
+			Follow:     t.follow,
+			Timestamps: true,
+		}
+		if fresh {
+			if t.o.tailLines >= 0 {
+				tail := t.o.tailLines
+				opts.TailLines = &tail
+			}
+			if t.o.since > 0 {
+				seconds := int64(t.o.since.Seconds())
+				opts.SinceSeconds = &seconds
+			}
+		}
+
+		prefix := pod.Name
+		if len(containers) > 1 {
+			prefix = fmt.Sprintf("%s/%s", pod.Name, st.Name)
+		}
+		if len(prefix) > t.width {
+			t.width = len(prefix)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		streams[st.ContainerID] = cancel
+		t.wg.Add(1)
+		go func(pod *corev1.Pod, opts *corev1.PodLogOptions, prefix string, color int) {
+			defer t.wg.Done()
+			defer cancel()
+			if t.sem != nil {
+				t.sem <- struct{}{}
+				defer func() { <-t.sem }()
+			}
+			t.stream(ctx, pod, opts, prefix, color)
+		}(pod, opts, prefix, t.colors[uid])
+	}
+}
+
+func (t *logTailer) stream(ctx context.Context, pod *corev1.Pod, opts *corev1.PodLogOptions, prefix string, color int) {
+	add := func(ts time.Time, text string) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.lines = append(t.lines, logLine{time: ts, received: time.Now(), prefix: prefix, color: color, text: text})
+	}
+
+	rc, err := t.o.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			add(time.Now(), fmt.Sprintf("<failed to stream logs: %v>", err))
+		}
+		return
+	}
+	defer rc.Close()
+
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		ts := time.Now()
+		if idx := strings.IndexByte(line, ' '); idx > 0 {
+			if parsed, err := time.Parse(time.RFC3339Nano, line[:idx]); err == nil {
+				ts, line = parsed, line[idx+1:]
+			}
+		}
+		add(ts, line)
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		add(time.Now(), fmt.Sprintf("<log stream broken: %v>", err))
+	}
+}
+
+// flush prints the lines received before the cutoff in the order of their
+// timestamps. The prefixes are padded to the longest one observed so far.
+func (t *logTailer) flush(cutoff time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ready, pending []logLine
+	for _, l := range t.lines {
+		if l.received.After(cutoff) {
+			pending = append(pending, l)
+		} else {
+			ready = append(ready, l)
+		}
+	}
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].time.Before(ready[j].time)
+	})
+	colored := utils.IsTerminal(t.o.out)
+	for _, l := range ready {
+		prefix := fmt.Sprintf("%-*s | ", t.width, l.prefix)
+		if colored {
+			prefix = prefixColors[l.color%len(prefixColors)].Apply(prefix)
+		}
+		fmt.Fprintf(t.o.out, "%s%s\n", prefix, l.text)
+	}
+	t.lines = pending
+}
+
+// printLogs prints the logs of the pods merged by their timestamps, streaming
+// at most --max-concurrency containers at a time.
+func (o *Options) printLogs(pods []*corev1.Pod) error {
+	t := newLogTailer(o, false)
+	for _, pod := range pods {
+		t.observe(pod, false, true)
+	}
+	t.Close()
+	return nil
+}
@@ -0,0 +1,229 @@
+package podstatus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+
+	"github.com/knight42/k8s-tools/pkg/tabwriter"
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+const (
+	outputWide          = "wide"
+	outputJSON          = "json"
+	outputYAML          = "yaml"
+	outputName          = "name"
+	outputCustomColumns = "custom-columns="
+	outputJSONPath      = "jsonpath="
+)
+
+// PodInfo is the machine readable form of a row printed by kubectl pods.
+// Field names are part of the output schema and must stay stable.
+type PodInfo struct {
+	Name           string            `json:"name"`
+	Namespace      string            `json:"namespace"`
+	Phase          corev1.PodPhase   `json:"phase"`
+	Ready          string            `json:"ready"`
+	ReadyCount     int               `json:"readyCount"`
+	TotalCount     int               `json:"totalCount"`
+	Status         string            `json:"status"`
+	LastStatus     string            `json:"lastStatus,omitempty"`
+	Restarts       int32             `json:"restarts"`
+	PodIP          string            `json:"podIP,omitempty"`
+	HostIP         string            `json:"hostIP,omitempty"`
+	Node           string            `json:"node,omitempty"`
+	NominatedNode  string            `json:"nominatedNode,omitempty"`
+	ReadinessGates []string          `json:"readinessGates,omitempty"`
+	StartTime      *metav1.Time      `json:"startTime,omitempty"`
+	Usage          *ResourceUsage    `json:"usage,omitempty"`
+	Containers     []ContainerInfo   `json:"containers,omitempty"`
+	Explanation    string            `json:"explanation,omitempty"`
+	Endpoint       *EndpointInfo     `json:"endpoint,omitempty"`
+	Revision       string            `json:"revision,omitempty"`
+	VolumeClaims   []VolumeClaimInfo `json:"volumeClaims,omitempty"`
+}
+
+// ContainerInfo is the machine readable form of a container row in the expanded view.
+type ContainerInfo struct {
+	Name       string         `json:"name"`
+	Init       bool           `json:"init,omitempty"`
+	Ready      bool           `json:"ready"`
+	State      string         `json:"state,omitempty"`
+	LastStatus string         `json:"lastStatus,omitempty"`
+	Restarts   int32          `json:"restarts"`
+	Usage      *ResourceUsage `json:"usage,omitempty"`
+}
+
+// PodInfoList is the top level object printed by the json, yaml and jsonpath printers.
+type PodInfoList struct {
+	Items []PodInfo `json:"items"`
+}
+
+type printFunc func(w io.Writer, infos []PodInfo) error
+
+// newPrinter returns the printer for the given output format, or nil if
+// pods should be printed as a table.
+func newPrinter(format string) (printFunc, error) {
+	switch {
+	case format == "", format == outputWide:
+		return nil, nil
+	case format == outputJSON:
+		return printJSON, nil
+	case format == outputYAML:
+		return printYAML, nil
+	case format == outputName:
+		return printName, nil
+	case strings.HasPrefix(format, outputJSONPath):
+		return newJSONPathPrinter(strings.TrimPrefix(format, outputJSONPath))
+	case strings.HasPrefix(format, outputCustomColumns):
+		return newCustomColumnsPrinter(strings.TrimPrefix(format, outputCustomColumns))
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+func printJSON(w io.Writer, infos []PodInfo) error {
+	data, err := json.MarshalIndent(PodInfoList{Items: infos}, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func printYAML(w io.Writer, infos []PodInfo) error {
+	data, err := yaml.Marshal(PodInfoList{Items: infos})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, "---\n", string(data))
+	return err
+}
+
+func printName(w io.Writer, infos []PodInfo) error {
+	for _, info := range infos {
+		if _, err := fmt.Fprintf(w, "pod/%s\n", info.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toQueryObject converts v to the generic form expected by the jsonpath engine,
+// so that templates refer to the json field names.
+func toQueryObject(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var obj interface{}
+	err = json.Unmarshal(data, &obj)
+	return obj, err
+}
+
+// relaxedJSONPath accepts `.name`, `name` and `{.name}` alike.
+func relaxedJSONPath(path string) string {
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "{"), "}")
+	if !strings.HasPrefix(path, ".") {
+		path = "." + path
+	}
+	return "{" + path + "}"
+}
+
+func newJSONPathPrinter(tmpl string) (printFunc, error) {
+	j := jsonpath.New("out")
+	if err := j.Parse(tmpl); err != nil {
+		return nil, fmt.Errorf("parse jsonpath %q: %v", tmpl, err)
+	}
+	return func(w io.Writer, infos []PodInfo) error {
+		obj, err := toQueryObject(PodInfoList{Items: infos})
+		if err != nil {
+			return err
+		}
+		if err := j.Execute(w, obj); err != nil {
+			return fmt.Errorf("execute jsonpath %q: %v", tmpl, err)
+		}
+		_, err = fmt.Fprintln(w)
+		return err
+	}, nil
+}
+
+type column struct {
+	header string
+	path   *jsonpath.JSONPath
+}
+
+func newCustomColumnsPrinter(spec string) (printFunc, error) {
+	if len(spec) == 0 {
+		return nil, fmt.Errorf("custom-columns format specified but no custom columns given")
+	}
+	var columns []column
+	for _, part := range strings.Split(spec, ",") {
+		colSpec := strings.SplitN(part, ":", 2)
+		if len(colSpec) != 2 || len(colSpec[0]) == 0 || len(colSpec[1]) == 0 {
+			return nil, fmt.Errorf("unexpected custom-columns spec: %s, expected <header>:<json-path-expr>", part)
+		}
+		j := jsonpath.New(colSpec[0]).AllowMissingKeys(true)
+		if err := j.Parse(relaxedJSONPath(colSpec[1])); err != nil {
+			return nil, fmt.Errorf("parse column %s: %v", colSpec[0], err)
+		}
+		columns = append(columns, column{header: colSpec[0], path: j})
+	}
+
+	return func(w io.Writer, infos []PodInfo) error {
+		tw := tabwriter.New(w)
+		headers := make([]string, len(columns))
+		for i, col := range columns {
+			headers[i] = col.header
+		}
+		tw.SetHeader(headers)
+
+		for _, info := range infos {
+			obj, err := toQueryObject(info)
+			if err != nil {
+				return err
+			}
+			row := make([]interface{}, len(columns))
+			for i, col := range columns {
+				results, err := col.path.FindResults(obj)
+				if err != nil {
+					return err
+				}
+				var values []string
+				for _, result := range results {
+					for _, v := range result {
+						values = append(values, fmt.Sprint(v.Interface()))
+					}
+				}
+				row[i] = utils.OrNone(strings.Join(values, ","))
+			}
+			tw.Append(row...)
+		}
+		return tw.Render()
+	}, nil
+}
+
+// render flushes the pods collected so far with the selected printer.
+func (o *Options) render() error {
+	if o.printer == nil {
+		return o.writer.Render()
+	}
+	infos := o.infos
+	o.infos = nil
+	return o.printer(o.out, infos)
+}
+
+// infof prints informational lines which only make sense along with the table output.
+func (o *Options) infof(format string, args ...interface{}) {
+	if o.printer != nil {
+		return
+	}
+	_, _ = fmt.Fprintf(o.out, format, args...)
+}
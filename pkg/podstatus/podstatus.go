@@ -4,51 +4,107 @@ package podstatus
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
-	"k8s.io/apimachinery/pkg/watch"
-
 	"github.com/knight42/k8s-tools/pkg/tabwriter"
 	"github.com/knight42/k8s-tools/pkg/utils"
 
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
 
-	"k8s.io/apimachinery/pkg/api/meta"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/util/duration"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
-	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	metricsv1beta1api "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
 type Options struct {
 	configFlags *genericclioptions.ConfigFlags
 
-	namespace     string
-	watch         bool
-	watchOnly     bool
-	labelSelector string
-
-	args            []string
-	writer          *tabwriter.Writer
-	enforceResource bool
-	namePattern     *regexp.Regexp
-	pods            map[string]*corev1.Pod
+	namespace      string
+	watch          bool
+	watchOnly      bool
+	labelSelector  string
+	allNamespaces  bool
+	outputFormat   string
+	crashLogs      bool
+	tailLines      int64
+	showUsage      bool
+	showContainers bool
+	oomThreshold   float64
+	usageInterval  time.Duration
+	explain        bool
+	waitReady      bool
+	timeout        time.Duration
+	failureStates  []string
+	showTimeline   bool
+	timelineFile   string
+	timelineSum    bool
+	sortBy         string
+	statusFilters  []string
+	notReady       bool
+	restartsGt     int32
+	nodes          []string
+	groupBy        string
+	exec           bool
+	container      string
+	debugImage     string
+	maxConcurrency int
+	logs           bool
+	follow         bool
+	since          time.Duration
+	restart        bool
+	pause          bool
+	resume         bool
+	undo           string
+	undoRevision   int64
+
+	args          []string
+	command       []string
+	restConfig    *rest.Config
+	clientset     kubernetes.Interface
+	metricsClient metricsclientset.Interface
+	podMetrics    map[string]*metricsv1beta1api.PodMetrics
+	screen        *screen
+	explanations  map[string]string
+	clusterNodes  map[string]*corev1.Node
+	targets       []*target
+	reconnecting  string
+	timeline      *timeline
+	logTailer     *logTailer
+	out           io.Writer
+	writer        *tabwriter.Writer
+	printer       printFunc
+	infos         []PodInfo
+	pods          map[string]*corev1.Pod
 }
 
 func NewOptions() *Options {
 	return &Options{
-		configFlags: genericclioptions.NewConfigFlags(true),
-		pods:        make(map[string]*corev1.Pod),
+		configFlags:    genericclioptions.NewConfigFlags(true),
+		out:            os.Stdout,
+		tailLines:      20,
+		oomThreshold:   90,
+		usageInterval:  30 * time.Second,
+		timeout:        10 * time.Minute,
+		maxConcurrency: 10,
+		sortBy:         sortByName,
+		restartsGt:     -1,
+		failureStates:  []string{"CrashLoopBackOff", "ImagePullBackOff", "ErrImagePull", "InvalidImageName", "CreateContainerConfigError"},
+		pods:           make(map[string]*corev1.Pod),
 	}
 }
 
 func NewCmd() *cobra.Command {
 	o := NewOptions()
 	cmd := &cobra.Command{
-		Use: "kubectl pods [NAME | -l label] [flags]",
+		Use: "kubectl pods [TYPE NAME... | TYPE/NAME...] [-l label] [flags] [--logs [-f] | --exec -- COMMAND [args...]]",
 		Run: func(cmd *cobra.Command, args []string) {
 			utils.CheckError(o.Complete(cmd, args))
 			utils.CheckError(o.Validate())
@@ -59,7 +115,40 @@ func NewCmd() *cobra.Command {
 	flags := cmd.Flags()
 	flags.BoolVarP(&o.watch, "watch", "w", false, "After listing/getting the requested object, watch for changes.")
 	flags.StringVarP(&o.labelSelector, "selector", "l", o.labelSelector, "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	flags.BoolVarP(&o.allNamespaces, "all-namespaces", "A", o.allNamespaces, "If present, list the pods across all namespaces. Namespace in current context is ignored even if specified with --namespace.")
 	flags.BoolVar(&o.watchOnly, "watch-only", o.watchOnly, "Watch for changes to the requested object(s), without listing/getting first.")
+	flags.StringVarP(&o.outputFormat, "output", "o", o.outputFormat, "Output format. One of: json|yaml|name|wide|custom-columns=...|jsonpath=...")
+	flags.BoolVar(&o.crashLogs, "crash-logs", o.crashLogs, "Print the previous logs of containers which have restarted or terminated under each pod.")
+	flags.Int64Var(&o.tailLines, "tail", o.tailLines, "Lines of recent log to display per container. Defaults to all lines with --logs.")
+	flags.BoolVar(&o.showUsage, "usage", o.showUsage, "Show CPU and memory usage from metrics-server along with requests and limits.")
+	flags.BoolVar(&o.showContainers, "containers", o.showContainers, "Show a row for each container under its pod.")
+	flags.Float64Var(&o.oomThreshold, "oom-threshold", o.oomThreshold, "Highlight containers whose memory usage exceeds this percentage of the memory limit.")
+	flags.DurationVar(&o.usageInterval, "usage-interval", o.usageInterval, "Interval to refresh the resource usage in watch mode.")
+	flags.BoolVar(&o.explain, "explain", o.explain, "Explain why each pod is pending or not ready.")
+	flags.BoolVar(&o.waitReady, "wait-ready", o.waitReady, "Watch until every selected pod is ready and the desired replicas are met. Exit with 1 if a pod enters a failure state, 2 on timeout, or 130 if interrupted.")
+	flags.DurationVar(&o.timeout, "timeout", o.timeout, "The length of time to wait with --wait-ready, zero means never.")
+	flags.StringSliceVar(&o.failureStates, "fail-on", o.failureStates, "Pod statuses which make --wait-ready fail immediately.")
+	flags.BoolVar(&o.showTimeline, "timeline", o.showTimeline, "Watch and print the timestamped status transitions of pods instead of the table.")
+	flags.StringVar(&o.timelineFile, "timeline-file", o.timelineFile, "Append the status transitions to the file as JSON lines, requires --timeline.")
+	flags.BoolVar(&o.timelineSum, "timeline-summary", o.timelineSum, "Print the time to scheduled, time to ready and restarts of each pod on exit, requires --timeline.")
+	flags.StringVar(&o.sortBy, "sort-by", o.sortBy, "Sort the pods by one of: "+strings.Join(sortKeys, "|")+".")
+	flags.StringSliceVar(&o.statusFilters, "status", o.statusFilters, "Only show pods in these statuses as shown in the status column, prefix with '!' to exclude (e.g. --status='!Running').")
+	flags.BoolVar(&o.notReady, "not-ready", o.notReady, "Only show pods which are not running with all containers ready.")
+	flags.Int32Var(&o.restartsGt, "restarts-gt", o.restartsGt, "Only show pods which have restarted more than this number of times.")
+	flags.StringSliceVar(&o.nodes, "node", o.nodes, "Only show pods on these nodes.")
+	flags.StringVar(&o.groupBy, "group-by", o.groupBy, "Aggregate the pods by node, zone or a node label (label:<key>), and check their spread against the topology spread constraints and anti-affinity.")
+	flags.BoolVar(&o.exec, "exec", o.exec, "Run the command after '--' concurrently in every selected pod, and summarize the exit codes.")
+	flags.StringVarP(&o.container, "container", "c", o.container, "Container to run the command in with --exec, or to print the logs of with --logs. Defaults to the first container of each pod for --exec, all containers for --logs.")
+	flags.StringVar(&o.debugImage, "debug-image", o.debugImage, "Run the command of --exec in an ephemeral container of this image targeting the container, for images without a shell.")
+	flags.IntVar(&o.maxConcurrency, "max-concurrency", o.maxConcurrency, "Maximum number of pods to run the command of --exec in, or of containers to print the logs of with --logs and without --follow, at the same time.")
+	flags.BoolVar(&o.logs, "logs", o.logs, "Print the logs of the containers of every selected pod, merged by their timestamps.")
+	flags.BoolVarP(&o.follow, "follow", "f", o.follow, "Follow the logs with --logs, streaming the pods and containers as they start.")
+	flags.DurationVar(&o.since, "since", o.since, "Only print the logs newer than a relative duration like 5s, 2m, or 3h with --logs. All lines are printed unless --tail is given as well.")
+	flags.BoolVar(&o.restart, "restart", o.restart, "Restart the pods of the Deployments, StatefulSets or DaemonSets like `kubectl rollout restart`, then watch the rollout.")
+	flags.BoolVar(&o.pause, "pause", o.pause, "Pause the rollout of the Deployments.")
+	flags.BoolVar(&o.resume, "resume", o.resume, "Resume the rollout of the paused Deployments, then watch the rollout.")
+	flags.StringVar(&o.undo, "undo", o.undo, "Roll back the Deployments, StatefulSets or DaemonSets to the previous revision, or to the revision given as --undo=<revision>, then watch the rollout.")
+	flags.Lookup("undo").NoOptDefVal = "0"
 
 	o.configFlags.AddFlags(cmd.PersistentFlags())
 
@@ -74,19 +163,36 @@ func (o *Options) Complete(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	o.args = args
-	switch len(args) {
-	case 2:
-		o.enforceResource = true
-	case 1:
-		o.namePattern, err = regexp.Compile(args[0])
-		if err != nil {
-			return err
-		}
+	if n := cmd.ArgsLenAtDash(); n >= 0 {
+		o.args, o.command = args[:n], args[n:]
+	} else {
+		o.args = args
+	}
+
+	if o.logs && !cmd.Flags().Changed("tail") {
+		// print all the lines like kubectl logs, the default is for --crash-logs
+		o.tailLines = -1
 	}
 
-	o.writer = tabwriter.New(os.Stdout)
-	o.writer.SetHeader([]string{"name", "ready", "status", "last status", "restarts", "podip", "hostip", "node", "age"})
+	o.printer, err = newPrinter(o.outputFormat)
+	if err != nil {
+		return err
+	}
+
+	o.writer = o.newTableWriter(o.out)
+
+	o.restConfig, err = o.configFlags.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	o.clientset, err = kubernetes.NewForConfig(o.restConfig)
+	if err != nil {
+		return err
+	}
+	o.metricsClient, err = metricsclientset.NewForConfig(o.restConfig)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -95,198 +201,334 @@ func (o *Options) Validate() error {
 	if len(o.labelSelector) == 0 && len(o.args) == 0 {
 		return fmt.Errorf("must specify label selector or name")
 	}
-	if len(o.labelSelector) != 0 && len(o.args) != 0 {
-		return fmt.Errorf("cannot use label selector and name at the same time")
+	if o.crashLogs {
+		if o.printer != nil {
+			return fmt.Errorf("--crash-logs cannot be used with -o %s", o.outputFormat)
+		}
+		if o.watch || o.watchOnly {
+			return fmt.Errorf("--crash-logs cannot be used with --watch")
+		}
+		if o.tailLines <= 0 {
+			return fmt.Errorf("--tail must be greater than 0")
+		}
+	}
+	action, err := o.rolloutAction()
+	if err != nil {
+		return err
+	}
+	if len(action) != 0 {
+		if o.exec || o.logs || o.crashLogs || o.explain {
+			return fmt.Errorf("--%s cannot be used with --exec, --logs, --crash-logs or --explain", action)
+		}
+		if len(o.undo) != 0 {
+			o.undoRevision, err = strconv.ParseInt(o.undo, 10, 64)
+			if err != nil || o.undoRevision < 0 {
+				return fmt.Errorf("invalid --undo revision %q", o.undo)
+			}
+		}
+		if o.rollingOut() {
+			// watch the rollout until it completes or fails
+			o.waitReady = true
+		}
+	}
+	if o.waitReady {
+		if o.watchOnly {
+			return fmt.Errorf("--wait-ready cannot be used with --watch-only")
+		}
+		if o.timeout < 0 {
+			return fmt.Errorf("--timeout must not be negative")
+		}
+		o.watch = true
+	}
+	if o.showTimeline {
+		if o.printer != nil {
+			return fmt.Errorf("--timeline cannot be used with -o %s, use --timeline-file instead", o.outputFormat)
+		}
+		o.watch = true
+	} else if len(o.timelineFile) != 0 || o.timelineSum {
+		return fmt.Errorf("--timeline-file and --timeline-summary require --timeline")
+	}
+	if o.explain && (o.watch || o.watchOnly) {
+		return fmt.Errorf("--explain cannot be used with --watch")
+	}
+	if !validSortKey(o.sortBy) {
+		return fmt.Errorf("invalid --sort-by %q, must be one of: %s", o.sortBy, strings.Join(sortKeys, ", "))
+	}
+	if len(o.groupBy) != 0 {
+		if !validGroupBy(o.groupBy) {
+			return fmt.Errorf("invalid --group-by %q, must be one of: node, zone, label:<key>", o.groupBy)
+		}
+		if o.printer != nil {
+			return fmt.Errorf("--group-by cannot be used with -o %s", o.outputFormat)
+		}
+		if o.crashLogs || o.explain || o.showTimeline {
+			return fmt.Errorf("--group-by cannot be used with --crash-logs, --explain or --timeline")
+		}
+	}
+	if o.logs {
+		if o.printer != nil {
+			return fmt.Errorf("--logs cannot be used with -o %s", o.outputFormat)
+		}
+		if o.exec || o.crashLogs || o.explain || len(o.groupBy) != 0 {
+			return fmt.Errorf("--logs cannot be used with --exec, --crash-logs, --explain or --group-by")
+		}
+		if o.waitReady || o.showTimeline {
+			return fmt.Errorf("--logs cannot be used with --wait-ready or --timeline")
+		}
+		if o.follow {
+			o.watch = true
+		} else if o.watch || o.watchOnly {
+			return fmt.Errorf("use --follow instead of --watch with --logs")
+		}
+		if o.since < 0 {
+			return fmt.Errorf("--since must not be negative")
+		}
+	} else if o.follow || o.since != 0 {
+		return fmt.Errorf("--follow and --since require --logs")
+	}
+	if o.maxConcurrency <= 0 {
+		return fmt.Errorf("--max-concurrency must be greater than 0")
+	}
+	if o.exec {
+		if len(o.command) == 0 {
+			return fmt.Errorf("--exec requires a command after '--'")
+		}
+		if o.printer != nil {
+			return fmt.Errorf("--exec cannot be used with -o %s", o.outputFormat)
+		}
+		if o.watch || o.watchOnly || o.waitReady || o.showTimeline {
+			return fmt.Errorf("--exec cannot be used with --watch, --wait-ready or --timeline")
+		}
+		if o.crashLogs || o.explain || len(o.groupBy) != 0 {
+			return fmt.Errorf("--exec cannot be used with --crash-logs, --explain or --group-by")
+		}
+	} else if len(o.command) != 0 {
+		return fmt.Errorf("a command after '--' requires --exec")
+	} else if len(o.debugImage) != 0 {
+		return fmt.Errorf("--debug-image requires --exec")
+	} else if len(o.container) != 0 && !o.logs {
+		return fmt.Errorf("--container requires --exec or --logs")
+	}
+	if o.showUsage && o.usageInterval <= 0 {
+		return fmt.Errorf("--usage-interval must be greater than 0")
 	}
 	return nil
 }
 
 func (o *Options) Run() error {
-	var (
-		r        *resource.Result
-		err      error
-		selector string
-	)
-
-	if len(o.labelSelector) != 0 {
-		selector = o.labelSelector
-	} else if o.enforceResource {
-		r = newBuilder(o.configFlags).
-			NamespaceParam(o.namespace).DefaultNamespace().
-			SingleResourceType().
-			ResourceTypeOrNameArgs(false, o.args...).
-			Do()
-
-		if err = r.Err(); err != nil {
+	targets, err := o.resolveTargets()
+	if err != nil {
+		return err
+	}
+	o.targets = targets
+
+	if err := o.fetchContext(); err != nil {
+		return err
+	}
+	if action, _ := o.rolloutAction(); len(action) != 0 {
+		if err := o.rollout(action); err != nil {
 			return err
 		}
-
-		obj, err := r.Object()
-		if err != nil {
+		// refresh the workloads after the rollout is triggered
+		if err := o.fetchContext(); err != nil {
 			return err
 		}
-
-		if isHPA(obj) {
-			obj, err = getRefObject(obj, o.configFlags)
-			if err != nil {
-				return err
-			}
-		} else if isPod(obj) {
-			pod := obj.(*corev1.Pod)
-			return o.handleSinglePod(pod)
+	}
+	if o.exec {
+		pods, err := o.allPods()
+		if err != nil {
+			return err
 		}
-		selector, err = getSelectorFromObject(obj)
+		return o.execPods(o.selectPods(pods))
+	}
+	if o.logs && !o.follow {
+		pods, err := o.allPods()
 		if err != nil {
 			return err
 		}
-	} else {
-		panic(fmt.Errorf("TODO"))
+		return o.printLogs(o.selectPods(pods))
+	}
+	if len(targets) == 1 && targets[0].pod != nil && !o.watch && !o.watchOnly {
+		return o.handleSinglePod(targets[0].pod)
 	}
 
-	o.labelSelector = selector
-	fmt.Printf("Selector: -l%s\n\n", selector)
+	if o.showUsage {
+		o.loadPodMetrics()
+	}
 
 	if o.watch || o.watchOnly {
-		return o.watchPods()
+		if len(targets) == 1 && !o.logs {
+			o.printTargetHeader(targets[0], false)
+		}
+		if err := o.watchPods(); err != nil || !o.rollingOut() || o.screen != nil {
+			return err
+		}
+		// the change log does not show how the rollouts end
+		for _, t := range targets {
+			for _, line := range o.rolloutLines(t) {
+				o.infof("%s\n", line)
+			}
+		}
+		return nil
 	}
 
-	r = newBuilder(o.configFlags).
-		NamespaceParam(o.namespace).DefaultNamespace().
-		LabelSelector(selector).
-		ResourceTypes("pods").
-		Flatten().
-		Do()
-
-	if err := r.Err(); err != nil {
-		return err
+	if o.printer != nil {
+		// structured output is a single list of every selected pod
+		pods, err := o.allPods()
+		if err != nil {
+			return err
+		}
+		return o.printPodList(nil, o.selectPods(pods))
 	}
 
-	err = r.Visit(func(info *resource.Info, err error) error {
+	for i, t := range targets {
+		if i > 0 {
+			fmt.Fprintln(o.out)
+		}
+		o.printTargetHeader(t, true)
+		pods, err := o.listPods(t)
 		if err != nil {
 			return err
 		}
+		shown := o.selectPods(pods)
+		if len(o.groupBy) != 0 {
+			for _, line := range o.spreadLines(shown, pods) {
+				fmt.Fprintln(o.out, line)
+			}
+		} else if err := o.printPodList(t, shown); err != nil {
+			return err
+		}
+		o.infof("%s\n", statusFooter(shown, len(pods)))
+		for _, line := range o.targetFooter(t, pods) {
+			o.infof("%s\n", line)
+		}
+	}
+	return nil
+}
 
-		return o.PrintPod(info.Object, false)
-	})
-	_ = o.writer.Render()
-
-	return err
+// allPods lists the pods of every target, without duplicates.
+func (o *Options) allPods() ([]*corev1.Pod, error) {
+	var pods []*corev1.Pod
+	seen := make(map[string]bool)
+	for _, t := range o.targets {
+		targetPods, err := o.listPods(t)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range targetPods {
+			if !seen[string(pod.UID)] {
+				seen[string(pod.UID)] = true
+				pods = append(pods, pod)
+			}
+		}
+	}
+	return pods, nil
 }
 
-func (o *Options) handleSinglePod(pod *corev1.Pod) error {
-	podEvtSelector := fields.AndSelectors(
-		fields.OneTermEqualSelector("involvedObject.name", pod.Name),
-		fields.OneTermEqualSelector("involvedObject.namespace", pod.Namespace),
-		fields.OneTermEqualSelector("involvedObject.uid", string(pod.UID)),
-	)
-	r := newBuilder(o.configFlags).
-		NamespaceParam(o.namespace).DefaultNamespace().
-		FieldSelectorParam(podEvtSelector.String()).
-		SingleResourceType().
-		ResourceTypes("events").
-		Flatten().
-		Do()
-	if err := r.Err(); err != nil {
-		return err
+// fetchContext refreshes the endpoints, the panels of HPAs, CronJobs and
+// StatefulSets, the nodes of DaemonSets or the pods are grouped by, and the
+// Deployments being waited for.
+func (o *Options) fetchContext() error {
+	if o.showEndpoints() {
+		if err := o.fetchEndpoints(); err != nil {
+			return err
+		}
 	}
-	evtPrinter := tabwriter.New(os.Stdout)
-	evtPrinter.SetHeader([]string{"Type", "Reason", "Age", "From", "Message"})
-	err := r.Visit(func(info *resource.Info, err error) error {
-		if err != nil {
+	if o.hasHPA() {
+		if err := o.fetchHPAs(); err != nil {
 			return err
 		}
-		evt, ok := info.Object.(*corev1.Event)
-		if !ok {
-			return fmt.Errorf("not event: %s", info.Object)
-		}
-		age := fmt.Sprintf(
-			"%s (x%d over %s)",
-			duration.ShortHumanDuration(time.Since(evt.LastTimestamp.Time)),
-			evt.Count,
-			duration.ShortHumanDuration(evt.LastTimestamp.Sub(evt.FirstTimestamp.Time)),
-		)
-		from := fmt.Sprintf("%s, %s", evt.Source.Component, evt.Source.Host)
-		evtPrinter.Append(evt.Type, evt.Reason, age, from, evt.Message)
-		return nil
-	})
-	if err != nil {
-		return err
 	}
-	fmt.Printf("Events:\n")
-	_ = evtPrinter.Render()
-	fmt.Println()
-	fmt.Printf("Pod: %s/%s\n", pod.Namespace, pod.Name)
-
-	if o.watch || o.watchOnly {
-		return fmt.Errorf("watching single pod is not supported now")
+	if o.hasCronJob() {
+		if err := o.fetchCronJobs(); err != nil {
+			return err
+		}
+	}
+	if o.hasStatefulSet() {
+		if err := o.fetchStatefulSets(); err != nil {
+			return err
+		}
+	}
+	if o.hasDaemonSet() {
+		if err := o.fetchDaemonSets(); err != nil {
+			return err
+		}
+	}
+	if o.waitReady && o.hasDeployment() {
+		if err := o.fetchDeployments(); err != nil {
+			return err
+		}
+	}
+	if len(o.groupBy) != 0 {
+		return o.fetchNodes()
 	}
-	_ = o.PrintPod(pod, false)
-	_ = o.writer.Render()
 	return nil
 }
 
-func (o *Options) watchPods() error {
-	r := newBuilder(o.configFlags).
-		NamespaceParam(o.namespace).DefaultNamespace().
-		SingleResourceType().
-		LabelSelector(o.labelSelector).
-		ResourceTypes("pods").
-		Do()
-
-	if err := r.Err(); err != nil {
-		return err
-	}
+// hasContext reports whether there are endpoints, panels or nodes which need
+// refreshing in watch mode.
+func (o *Options) hasContext() bool {
+	return o.showEndpoints() || o.hasHPA() || o.hasCronJob() || o.hasStatefulSet() || o.hasDaemonSet() || o.waitReady && o.hasDeployment() || len(o.groupBy) != 0
+}
 
-	obj, err := r.Object()
-	if err != nil {
-		return err
+// printPodList prints the pods of the target in the given order, along with
+// the extra sections asked for. The target is nil if the pods are not grouped.
+func (o *Options) printPodList(t *target, pods []*corev1.Pod) error {
+	if o.explain {
+		if err := o.explainPods(pods); err != nil {
+			return err
+		}
 	}
 
-	rv, err := meta.NewAccessor().ResourceVersion(obj)
-	if err != nil {
-		return err
+	if o.crashLogs {
+		if err := o.printPodsWithCrashLogs(pods); err != nil {
+			return err
+		}
+	} else if t != nil && t.cronJob != nil && o.printer == nil {
+		for _, line := range o.jobHistoryLines(t, pods, 0) {
+			fmt.Fprintln(o.out, line)
+		}
+	} else {
+		for _, pod := range pods {
+			_ = o.PrintPod(pod, false)
+		}
+		if err := o.render(); err != nil {
+			return err
+		}
 	}
 
-	if !o.watchOnly {
-		objsToPrint, _ := meta.ExtractList(obj)
-		for _, objToPrint := range objsToPrint {
-			pod, ok := objToPrint.(*corev1.Pod)
-			if !ok {
-				continue
-			}
-			o.pods[string(pod.UID)] = pod
-			_ = o.PrintPod(objToPrint, false)
-		}
-		_ = o.writer.Render()
+	if o.explain && o.printer == nil {
+		return o.printExplanations(pods)
 	}
+	return nil
+}
 
-	watcher, err := r.Watch(rv)
+func (o *Options) handleSinglePod(pod *corev1.Pod) error {
+	events, err := o.getPodEvents(pod)
 	if err != nil {
 		return err
 	}
-
-	defer watcher.Stop()
-
-	for ev := range watcher.ResultChan() {
-		pod, ok := ev.Object.(*corev1.Pod)
-		if !ok {
-			continue
-		}
-		n := len(o.pods) + 1
-		for n > 0 {
-			cursorUp(os.Stdout, 1)
-			clearLine(os.Stdout)
-			n--
+	if o.printer == nil {
+		evtPrinter := tabwriter.New(os.Stdout)
+		evtPrinter.SetHeader([]string{"Type", "Reason", "Age", "From", "Message"})
+		for _, evt := range events {
+			age := fmt.Sprintf(
+				"%s (x%d over %s)",
+				duration.ShortHumanDuration(time.Since(evt.LastTimestamp.Time)),
+				evt.Count,
+				duration.ShortHumanDuration(evt.LastTimestamp.Sub(evt.FirstTimestamp.Time)),
+			)
+			from := fmt.Sprintf("%s, %s", evt.Source.Component, evt.Source.Host)
+			evtPrinter.Append(evt.Type, evt.Reason, age, from, evt.Message)
 		}
-		switch ev.Type {
-		case watch.Added:
-			o.pods[string(pod.UID)] = pod
-		case watch.Modified:
-			o.pods[string(pod.UID)] = pod
-		case watch.Deleted:
-			delete(o.pods, string(pod.UID))
-		}
-		o.printPods()
+		fmt.Printf("Events:\n")
+		_ = evtPrinter.Render()
+		fmt.Println()
+		fmt.Printf("Pod: %s/%s\n", pod.Namespace, pod.Name)
 	}
-	return nil
+
+	if o.showUsage {
+		o.loadPodMetrics()
+	}
+	return o.printPodList(nil, []*corev1.Pod{pod})
 }
@@ -2,15 +2,21 @@ package podstatus
 
 import (
 	"fmt"
+	"io"
 	"sort"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/duration"
+
+	"github.com/knight42/k8s-tools/pkg/tabwriter"
+	"github.com/knight42/k8s-tools/pkg/utils"
 )
 
-func (o *Options) printPods() {
+// sortedPods returns the watched pods sorted by name.
+func (o *Options) sortedPods() []*corev1.Pod {
 	podsList := make([]*corev1.Pod, 0, len(o.pods))
 	for _, pod := range o.pods {
 		podsList = append(podsList, pod)
@@ -18,136 +24,319 @@ func (o *Options) printPods() {
 	sort.Slice(podsList, func(i, j int) bool {
 		return podsList[i].Name < podsList[j].Name
 	})
-	for _, pod := range podsList {
-		_ = o.PrintPod(pod, false)
-	}
-	_ = o.writer.Render()
+	return podsList
 }
 
-// See also https://github.com/kubernetes/kubernetes/blob/master/pkg/printers/internalversion/printers.go#L579
-func (o *Options) PrintPod(obj runtime.Object, flush bool) error {
-	pod, ok := obj.(*corev1.Pod)
-	if !ok {
-		return fmt.Errorf("object is not a Pod: %#v", obj)
+func (o *Options) printPods() {
+	podsList := o.sortedPods()
+
+	if o.printer != nil {
+		for _, pod := range o.selectPods(podsList) {
+			_ = o.PrintPod(pod, false)
+		}
+		_ = o.render()
+		return
 	}
-	var (
-		readyCount int
-		totalCount       = len(pod.Spec.Containers)
-		restarts   int32 = 0
-	)
 
-	reason := string(pod.Status.Phase)
-	if pod.Status.Reason != "" {
-		reason = pod.Status.Reason
-	}
-
-	initializing := false
-	for i := range pod.Status.InitContainerStatuses {
-		ct := pod.Status.InitContainerStatuses[i]
-		restarts += ct.RestartCount
-		switch {
-		case ct.State.Terminated != nil && ct.State.Terminated.ExitCode == 0:
-			continue
-		case ct.State.Terminated != nil:
-			if len(ct.State.Terminated.Reason) != 0 {
-				if ct.State.Terminated.Signal != 0 {
-					reason = fmt.Sprintf("Init:Signal:%d", ct.State.Terminated.Signal)
-				} else {
-					reason = fmt.Sprintf("Init:ExitCode:%d", ct.State.Terminated.ExitCode)
+	// the header of a single target is printed once above the table, while
+	// the panels of HPAs, CronJobs and StatefulSets are refreshed along with the pods
+	grouped := len(o.targets) > 1
+	groups := o.groupPods(podsList)
+
+	if o.screen != nil {
+		var lines []string
+		for i, t := range o.targets {
+			if grouped {
+				if i > 0 {
+					lines = append(lines, "")
 				}
-			} else {
-				reason = "Init:" + ct.State.Terminated.Reason
+				lines = append(lines, t.header...)
 			}
-			initializing = true
-		case ct.State.Waiting != nil && len(ct.State.Waiting.Reason) > 0 && ct.State.Waiting.Reason != "PodInitializing":
-			reason = "Init:" + ct.State.Waiting.Reason
-			initializing = true
-		default:
-			reason = fmt.Sprintf("Init:%d/%d", i, len(pod.Spec.InitContainers))
-			initializing = true
-		}
-	}
-
-	if !initializing {
-		restarts = 0
-		hasRunning := false
-		for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
-			container := pod.Status.ContainerStatuses[i]
-
-			restarts += container.RestartCount
-			if container.State.Waiting != nil && container.State.Waiting.Reason != "" {
-				reason = container.State.Waiting.Reason
-			} else if container.State.Terminated != nil && container.State.Terminated.Reason != "" {
-				reason = container.State.Terminated.Reason
-			} else if container.State.Terminated != nil && container.State.Terminated.Reason == "" {
-				if container.State.Terminated.Signal != 0 {
-					reason = fmt.Sprintf("Signal:%d", container.State.Terminated.Signal)
-				} else {
-					reason = fmt.Sprintf("ExitCode:%d", container.State.Terminated.ExitCode)
-				}
-			} else if container.Ready && container.State.Running != nil {
-				hasRunning = true
-				readyCount++
+			lines = append(lines, t.panel...)
+			if grouped || len(t.panel) != 0 {
+				lines = append(lines, "")
+			}
+			shown := o.selectPods(groups[i])
+			switch {
+			case len(o.groupBy) != 0:
+				lines = append(lines, o.spreadLines(shown, groups[i])...)
+			case t.cronJob != nil:
+				lines = append(lines, o.jobHistoryLines(t, shown, o.screen.width()-1)...)
+			default:
+				lines = append(lines, o.tableLines(shown)...)
 			}
+			lines = append(lines, statusFooter(shown, len(groups[i])))
+			if !o.watchOnly {
+				// only the changed pods are known with --watch-only
+				lines = append(lines, o.targetFooter(t, groups[i])...)
+			}
+		}
+		if len(o.reconnecting) != 0 {
+			lines = append(lines, fmt.Sprintf("(reconnecting: %s)", o.reconnecting))
 		}
+		o.screen.draw(lines)
+		return
+	}
 
-		if pod.DeletionTimestamp != nil && pod.Status.Reason == "NodeLost" {
-			reason = "Unknown"
-		} else if pod.DeletionTimestamp != nil {
-			reason = "Terminating"
+	for i, t := range o.targets {
+		if grouped {
+			if i > 0 {
+				fmt.Fprintln(o.out)
+			}
+			o.printTargetHeader(t, true)
+		} else if len(t.panel) != 0 {
+			for _, line := range t.panel {
+				o.infof("%s\n", line)
+			}
+			o.infof("\n")
+		}
+		shown := o.selectPods(groups[i])
+		if len(o.groupBy) != 0 {
+			for _, line := range o.spreadLines(shown, groups[i]) {
+				fmt.Fprintln(o.out, line)
+			}
+		} else {
+			_ = o.printPodList(t, shown)
 		}
+		o.infof("%s\n", statusFooter(shown, len(groups[i])))
+		for _, line := range o.targetFooter(t, groups[i]) {
+			o.infof("%s\n", line)
+		}
+	}
+}
+
+func newPodInfo(pod *corev1.Pod) PodInfo {
+	s := Compute(pod)
+
+	var readinessGates []string
+	for _, gate := range pod.Spec.ReadinessGates {
+		readinessGates = append(readinessGates, string(gate.ConditionType))
+	}
 
-		// change pod status back to "Running" if there is at least one container still reporting as "Running" status
-		if reason == "Completed" && hasRunning {
-			reason = "Running"
+	return PodInfo{
+		Name:           pod.Name,
+		Namespace:      pod.Namespace,
+		Phase:          pod.Status.Phase,
+		Ready:          fmt.Sprintf("%d/%d", s.Ready, s.Total),
+		ReadyCount:     s.Ready,
+		TotalCount:     s.Total,
+		Status:         s.Reason,
+		LastStatus:     s.LastTermination,
+		Restarts:       s.Restarts,
+		PodIP:          pod.Status.PodIP,
+		HostIP:         pod.Status.HostIP,
+		Node:           pod.Spec.NodeName,
+		NominatedNode:  pod.Status.NominatedNodeName,
+		ReadinessGates: readinessGates,
+		StartTime:      pod.Status.StartTime,
+	}
+}
+
+// podInfo returns the info of the pod, together with the resource usage,
+// containers and diagnosis if they are asked for.
+func (o *Options) podInfo(pod *corev1.Pod) PodInfo {
+	info := newPodInfo(pod)
+	if o.showUsage {
+		info.Usage = o.podUsage(pod)
+	}
+	if o.showContainers {
+		info.Containers = o.containerInfos(pod)
+	}
+	info.Explanation = o.explanations[string(pod.UID)]
+	info.Endpoint = o.podEndpoint(pod)
+	info.Revision = o.podRevision(pod)
+	info.VolumeClaims = o.podVolumeClaims(pod)
+	return info
+}
+
+func containerState(state corev1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return "Running"
+	case state.Waiting != nil:
+		if state.Waiting.Reason != "" {
+			return state.Waiting.Reason
+		}
+		return "Waiting"
+	case state.Terminated != nil:
+		if state.Terminated.Reason != "" {
+			return state.Terminated.Reason
 		}
+		if state.Terminated.Signal != 0 {
+			return fmt.Sprintf("Signal:%d", state.Terminated.Signal)
+		}
+		return fmt.Sprintf("ExitCode:%d", state.Terminated.ExitCode)
+	}
+	return ""
+}
+
+func (o *Options) containerInfos(pod *corev1.Pod) []ContainerInfo {
+	statuses := make(map[string]corev1.ContainerStatus)
+	for _, st := range pod.Status.InitContainerStatuses {
+		statuses["init:"+st.Name] = st
+	}
+	for _, st := range pod.Status.ContainerStatuses {
+		statuses[st.Name] = st
 	}
 
-	lastReason := "<none>"
-	for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
-		container := pod.Status.ContainerStatuses[i]
-		lastTermState := container.LastTerminationState
-		if lastTermState.Terminated != nil {
-			t := lastTermState.Terminated
-			lastReason = fmt.Sprintf("%s:%d", t.Reason, t.ExitCode)
-		} else if lastTermState.Waiting != nil {
-			lastReason = lastTermState.Waiting.Reason
+	newInfo := func(c *corev1.Container, init bool) ContainerInfo {
+		key := c.Name
+		if init {
+			key = "init:" + c.Name
+		}
+		st := statuses[key]
+		info := ContainerInfo{
+			Name:     c.Name,
+			Init:     init,
+			Ready:    st.Ready,
+			State:    containerState(st.State),
+			Restarts: st.RestartCount,
+		}
+		if t := st.LastTerminationState.Terminated; t != nil {
+			info.LastStatus = fmt.Sprintf("%s:%d", t.Reason, t.ExitCode)
 		}
+		if o.showUsage && !init {
+			info.Usage = o.containerUsage(pod, c)
+		}
+		return info
+	}
+
+	var infos []ContainerInfo
+	for i := range pod.Spec.InitContainers {
+		infos = append(infos, newInfo(&pod.Spec.InitContainers[i], true))
 	}
+	for i := range pod.Spec.Containers {
+		infos = append(infos, newInfo(&pod.Spec.Containers[i], false))
+	}
+	return infos
+}
 
-	nodeName := pod.Spec.NodeName
-	hostIP := pod.Status.HostIP
-	podIP := pod.Status.PodIP
+// containerRows returns the rows of the expanded view printed under the row of the pod.
+func (o *Options) containerRows(pod *corev1.Pod) [][]interface{} {
+	if !o.showContainers {
+		return nil
+	}
+	var rows [][]interface{}
+	for _, c := range o.containerInfos(pod) {
+		name := "└─ " + c.Name
+		if c.Init {
+			name = "└─ init:" + c.Name
+		}
+		ready := "0/1"
+		if c.Ready {
+			ready = "1/1"
+		}
+		var row []interface{}
+		if o.allNamespaces {
+			row = append(row, "")
+		}
+		row = append(row, name, ready, utils.OrNone(c.State), utils.OrNone(c.LastStatus), c.Restarts, "", "", "", "")
+		if o.outputFormat == outputWide {
+			row = append(row, "", "")
+		}
+		if o.showEndpoints() {
+			row = append(row, "", "", "")
+		}
+		if o.hasStatefulSet() {
+			row = append(row, "", "")
+		}
+		if o.showUsage {
+			row = append(row, o.usageCells(c.Usage)...)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (o *Options) tableRow(info PodInfo) []interface{} {
 	age := "<none>"
+	if info.StartTime != nil {
+		age = duration.ShortHumanDuration(time.Since(info.StartTime.Time))
+	}
 
-	if podIP == "" {
-		podIP = "<none>"
+	var row []interface{}
+	if o.allNamespaces {
+		row = append(row, info.Namespace)
+	}
+	row = append(row,
+		info.Name,
+		info.Ready,
+		info.Status,
+		utils.OrNone(info.LastStatus),
+		info.Restarts,
+		utils.OrNone(info.PodIP),
+		utils.OrNone(info.HostIP),
+		utils.OrNone(info.Node),
+		age,
+	)
+	if o.outputFormat == outputWide {
+		gates := "<none>"
+		if len(info.ReadinessGates) > 0 {
+			gates = strings.Join(info.ReadinessGates, ",")
+		}
+		row = append(row, utils.OrNone(info.NominatedNode), gates)
 	}
-	if nodeName == "" {
-		nodeName = "<none>"
+	if o.showEndpoints() {
+		row = append(row, o.endpointCells(info)...)
 	}
-	if hostIP == "" {
-		hostIP = "<none>"
+	if o.hasStatefulSet() {
+		row = append(row, statefulSetCells(info)...)
 	}
-	if pod.Status.StartTime != nil {
-		age = duration.ShortHumanDuration(time.Since(pod.Status.StartTime.Time))
+	if o.showUsage {
+		row = append(row, o.usageCells(info.Usage)...)
 	}
+	return row
+}
 
-	args := []interface{}{
-		pod.Name,
-		fmt.Sprintf("%d/%d", readyCount, totalCount),
-		reason,
-		lastReason,
-		restarts,
-		podIP,
-		hostIP,
-		nodeName,
-		age,
+func (o *Options) tableHeader() []string {
+	var header []string
+	if o.allNamespaces {
+		header = append(header, "namespace")
+	}
+	header = append(header, "name", "ready", "status", "last status", "restarts", "podip", "hostip", "node", "age")
+	if o.outputFormat == outputWide {
+		header = append(header, "nominated node", "readiness gates")
+	}
+	if o.showEndpoints() {
+		header = append(header, "endpoint", "ports", "zone")
+	}
+	if o.hasStatefulSet() {
+		header = append(header, "revision", "pvcs")
+	}
+	if o.showUsage {
+		header = append(header, "cpu(usage/req/lim)", "memory(usage/req/lim)")
+	}
+	return header
+}
+
+func (o *Options) newTableWriter(out io.Writer) *tabwriter.Writer {
+	w := tabwriter.New(out)
+	w.SetHeader(o.tableHeader())
+	return w
+}
+
+func (o *Options) PrintPod(obj runtime.Object, flush bool) error {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return fmt.Errorf("object is not a Pod: %#v", obj)
 	}
-	if flush {
-		_ = o.writer.AppendAndFlush(args...)
-	} else {
-		o.writer.Append(args...)
+
+	info := o.podInfo(pod)
+	if o.printer != nil {
+		o.infos = append(o.infos, info)
+		if flush {
+			return o.render()
+		}
+		return nil
+	}
+
+	rows := append([][]interface{}{o.tableRow(info)}, o.containerRows(pod)...)
+	for _, args := range rows {
+		if flush {
+			_ = o.writer.AppendAndFlush(args...)
+		} else {
+			o.writer.Append(args...)
+		}
 	}
 	return nil
 }
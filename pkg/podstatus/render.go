@@ -0,0 +1,274 @@
+package podstatus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/morikuni/aec"
+	"golang.org/x/crypto/ssh/terminal"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/knight42/k8s-tools/pkg/tabwriter"
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+const (
+	// keep in line with pkg/tabwriter
+	columnPadding  = 3
+	columnMinWidth = 6
+	minElidedWidth = 12
+	ellipsis       = "…"
+)
+
+var ansiEscapeRe = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// droppableColumns are dropped in order when the table does not fit in the terminal.
+var droppableColumns = []string{"hostip", "podip", "readiness gates", "nominated node", "zone", "ports", "pvcs", "last status"}
+
+// elidableColumns have their cells shortened when dropping columns is not enough.
+var elidableColumns = []string{"node", "name"}
+
+func visibleWidth(s string) int {
+	return utf8.RuneCountInString(ansiEscapeRe.ReplaceAllString(s, ""))
+}
+
+// truncateVisible cuts s to at most width visible characters, keeping the
+// escape sequences intact.
+func truncateVisible(s string, width int) string {
+	if visibleWidth(s) <= width {
+		return s
+	}
+	var (
+		buf     strings.Builder
+		visible int
+		escaped bool
+	)
+	for i := 0; i < len(s); {
+		if loc := ansiEscapeRe.FindStringIndex(s[i:]); loc != nil && loc[0] == 0 {
+			buf.WriteString(s[i : i+loc[1]])
+			i += loc[1]
+			escaped = true
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if visible == width-1 {
+			buf.WriteString(ellipsis)
+			break
+		}
+		buf.WriteRune(r)
+		visible++
+		i += size
+	}
+	if escaped {
+		buf.WriteString(aec.Reset)
+	}
+	return buf.String()
+}
+
+func elide(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + ellipsis
+}
+
+func tableWidth(widths []int) int {
+	total := 0
+	for i, w := range widths {
+		if i != len(widths)-1 {
+			w += columnPadding
+		}
+		if w < columnMinWidth {
+			w = columnMinWidth
+		}
+		total += w
+	}
+	return total
+}
+
+func columnWidths(header []string, rows [][]string) []int {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = visibleWidth(h)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if w := visibleWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	return widths
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// fitTable drops the less important columns and elides long cells so that the
+// table fits in the given width. Zero width means unlimited.
+func fitTable(header []string, rows [][]string, width int) ([]string, [][]string) {
+	if width <= 0 {
+		return header, rows
+	}
+
+	for _, col := range droppableColumns {
+		if tableWidth(columnWidths(header, rows)) <= width {
+			return header, rows
+		}
+		idx := indexOf(header, col)
+		if idx < 0 {
+			continue
+		}
+		header = append(header[:idx:idx], header[idx+1:]...)
+		for i, row := range rows {
+			rows[i] = append(row[:idx:idx], row[idx+1:]...)
+		}
+	}
+
+	for _, col := range elidableColumns {
+		idx := indexOf(header, col)
+		if idx < 0 {
+			continue
+		}
+		widths := columnWidths(header, rows)
+		excess := tableWidth(widths) - width
+		if excess <= 0 {
+			break
+		}
+		target := widths[idx] - excess
+		if target < minElidedWidth {
+			target = minElidedWidth
+		}
+		for _, row := range rows {
+			row[idx] = elide(row[idx], target)
+		}
+	}
+	return header, rows
+}
+
+// screen redraws a block of lines in place on a terminal.
+type screen struct {
+	out *os.File
+	// visible widths of the lines drawn last time
+	drawn []int
+}
+
+func newScreen(out io.Writer) *screen {
+	if !utils.IsTerminal(out) {
+		return nil
+	}
+	return &screen{out: out.(*os.File)}
+}
+
+// size returns the width and height of the terminal, or zeros if unknown.
+func (s *screen) size() (int, int) {
+	w, h, err := terminal.GetSize(int(s.out.Fd()))
+	if err != nil || w <= 0 || h <= 0 {
+		return 0, 0
+	}
+	return w, h
+}
+
+// width returns the width of the terminal, or zero if it is unknown.
+func (s *screen) width() int {
+	w, _ := s.size()
+	return w
+}
+
+// drawnRows returns how many terminal rows the last drawn lines occupy now,
+// the terminal may have been resized since and wrapped them.
+func (s *screen) drawnRows(width int) int {
+	rows := 0
+	for _, w := range s.drawn {
+		if width <= 0 || w <= width {
+			rows++
+			continue
+		}
+		rows += (w + width - 1) / width
+	}
+	return rows
+}
+
+// draw replaces the previously drawn lines with the given ones. The lines
+// beyond the height of the terminal are cut off, as the cursor cannot move
+// up past the top of the screen to redraw them.
+func (s *screen) draw(lines []string) {
+	width, height := s.size()
+	// leave a row for the cursor below the lines
+	if height > 0 && len(lines) > height-1 {
+		keep := height - 2
+		if keep < 1 {
+			keep = 1
+		}
+		lines = append(lines[:keep:keep], fmt.Sprintf("… %d more", len(lines)-keep))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(aec.Up(uint(s.drawnRows(width))).String())
+	buf.WriteString("\r")
+	buf.WriteString(aec.EraseDisplay(aec.EraseModes.Tail).String())
+
+	s.drawn = s.drawn[:0]
+	for _, line := range lines {
+		if width > 0 {
+			// never let a line wrap, otherwise we lose track of the cursor
+			line = truncateVisible(line, width-1)
+		}
+		s.drawn = append(s.drawn, visibleWidth(line))
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	_, _ = s.out.Write(buf.Bytes())
+}
+
+// tableLines renders the pods table to fit the terminal.
+func (o *Options) tableLines(pods []*corev1.Pod) []string {
+	lines, _ := o.renderTable(pods, o.screen.width()-1)
+	return lines
+}
+
+// renderTable renders the pods table within the given width, zero means
+// unlimited. It returns the lines starting with the header, and the number
+// of rows of each pod.
+func (o *Options) renderTable(pods []*corev1.Pod, width int) ([]string, []int) {
+	var cells [][]string
+	rowsOfPod := make([]int, len(pods))
+	for i, pod := range pods {
+		rows := append([][]interface{}{o.tableRow(o.podInfo(pod))}, o.containerRows(pod)...)
+		for _, row := range rows {
+			rowCells := make([]string, len(row))
+			for j, cell := range row {
+				rowCells[j] = fmt.Sprint(cell)
+			}
+			cells = append(cells, rowCells)
+		}
+		rowsOfPod[i] = len(rows)
+	}
+	header, cells := fitTable(o.tableHeader(), cells, width)
+
+	var buf bytes.Buffer
+	tw := tabwriter.New(&buf)
+	tw.SetHeader(header)
+	for _, row := range cells {
+		args := make([]interface{}, len(row))
+		for i, cell := range row {
+			args[i] = cell
+		}
+		tw.Append(args...)
+	}
+	_ = tw.Render()
+
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), rowsOfPod
+}
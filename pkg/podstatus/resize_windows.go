@@ -0,0 +1,8 @@
+package podstatus
+
+import (
+	"os"
+)
+
+// notifyResize is a no-op, there is no SIGWINCH on windows.
+func notifyResize(c chan<- os.Signal) {}
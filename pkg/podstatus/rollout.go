@@ -0,0 +1,440 @@
+package podstatus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	revisionAnnotation    = "deployment.kubernetes.io/revision"
+
+	timedOutReason = "ProgressDeadlineExceeded"
+)
+
+// rollbackSkippedAnnotations are kept from the Deployment rather than copied
+// from the ReplicaSet on rollback, as `kubectl rollout undo` does.
+var rollbackSkippedAnnotations = map[string]bool{
+	corev1.LastAppliedConfigAnnotation:          true,
+	revisionAnnotation:                          true,
+	"deployment.kubernetes.io/revision-history": true,
+	"deployment.kubernetes.io/desired-replicas": true,
+	"deployment.kubernetes.io/max-replicas":     true,
+	"deprecated.deployment.rollback.to":         true,
+}
+
+const (
+	actionRestart = "restart"
+	actionPause   = "pause"
+	actionResume  = "resume"
+	actionUndo    = "undo"
+)
+
+// rolloutAction returns the action given by --restart, --pause, --resume or
+// --undo, or an error if more than one is given.
+func (o *Options) rolloutAction() (string, error) {
+	var actions []string
+	if o.restart {
+		actions = append(actions, actionRestart)
+	}
+	if o.pause {
+		actions = append(actions, actionPause)
+	}
+	if o.resume {
+		actions = append(actions, actionResume)
+	}
+	if len(o.undo) != 0 {
+		actions = append(actions, actionUndo)
+	}
+	switch len(actions) {
+	case 0:
+		return "", nil
+	case 1:
+		return actions[0], nil
+	}
+	return "", fmt.Errorf("only one of --restart, --pause, --resume and --undo can be given")
+}
+
+// rollingOut reports whether we are watching a rollout triggered by
+// --restart, --resume or --undo.
+func (o *Options) rollingOut() bool {
+	return o.restart || o.resume || len(o.undo) != 0
+}
+
+// hasDeployment reports whether any of the targets is a Deployment.
+func (o *Options) hasDeployment() bool {
+	for _, t := range o.targets {
+		if t.deployment != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchDeployments refreshes the Deployment targets.
+func (o *Options) fetchDeployments() error {
+	for _, t := range o.targets {
+		if t.deployment == nil {
+			continue
+		}
+		d, err := o.clientset.AppsV1().Deployments(t.deployment.Namespace).Get(context.TODO(), t.deployment.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		t.deployment = d
+	}
+	return nil
+}
+
+// rolloutPlan is the patch of the action on a target, with the result
+// printed once it is sent. patch is nil if there is nothing to do.
+type rolloutPlan struct {
+	result string
+	patch  func() error
+}
+
+// rollout triggers the action on every target, an HPA on its scale target.
+// Every target is checked before any of them is patched, so that an
+// unsupported target does not leave the others half done.
+func (o *Options) rollout(action string) error {
+	plans := make([]rolloutPlan, len(o.targets))
+	for i, t := range o.targets {
+		var err error
+		// the workloads of HPAs are resolved by newObjectTarget
+		switch {
+		case t.deployment != nil:
+			plans[i], err = o.rolloutDeployment(t.deployment, action)
+		case t.statefulSet != nil:
+			plans[i], err = o.rolloutStatefulSet(t.statefulSet, action)
+		case t.daemonSet != nil:
+			plans[i], err = o.rolloutDaemonSet(t.daemonSet, action)
+		case len(t.hpaName) != 0:
+			err = fmt.Errorf("cannot %s the scale target of HorizontalPodAutoscaler %s, only Deployments, StatefulSets and DaemonSets can be rolled out", action, t.hpaName)
+		default:
+			err = fmt.Errorf("cannot %s, only Deployments, StatefulSets and DaemonSets can be rolled out", action)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", t.header[0], err)
+		}
+	}
+
+	for i, t := range o.targets {
+		if plans[i].patch != nil {
+			if err := plans[i].patch(); err != nil {
+				return fmt.Errorf("%s: %v", t.header[0], err)
+			}
+		}
+		o.infof("%s: %s\n", t.header[0], plans[i].result)
+	}
+	o.infof("\n")
+	return nil
+}
+
+func restartPatch() []byte {
+	return []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		restartedAtAnnotation, time.Now().Format(time.RFC3339)))
+}
+
+// pickRevision returns the revision to roll back to, which is the previous
+// one if revision is 0. The revisions are sorted newest first.
+func pickRevision(revisions []int64, revision int64) (int64, error) {
+	if revision == 0 {
+		if len(revisions) < 2 {
+			return 0, fmt.Errorf("no previous revision to roll back to")
+		}
+		return revisions[1], nil
+	}
+	for _, rev := range revisions {
+		if rev == revision {
+			return rev, nil
+		}
+	}
+	return 0, fmt.Errorf("revision %d not found", revision)
+}
+
+func sortRevisions(revisions []int64) {
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i] > revisions[j]
+	})
+}
+
+func (o *Options) rolloutDeployment(d *appsv1.Deployment, action string) (rolloutPlan, error) {
+	client := o.clientset.AppsV1().Deployments(d.Namespace)
+	plan := func(result string, pt types.PatchType, data []byte) rolloutPlan {
+		return rolloutPlan{result: result, patch: func() error {
+			_, err := client.Patch(context.TODO(), d.Name, pt, data, metav1.PatchOptions{})
+			return err
+		}}
+	}
+
+	switch action {
+	case actionRestart:
+		if d.Spec.Paused {
+			return rolloutPlan{}, fmt.Errorf("cannot restart a paused Deployment, resume it first")
+		}
+		return plan("restarted", types.StrategicMergePatchType, restartPatch()), nil
+	case actionPause:
+		if d.Spec.Paused {
+			return rolloutPlan{result: "already paused"}, nil
+		}
+		return plan("paused", types.StrategicMergePatchType, []byte(`{"spec":{"paused":true}}`)), nil
+	case actionResume:
+		if !d.Spec.Paused {
+			return rolloutPlan{result: "not paused"}, nil
+		}
+		return plan("resumed", types.StrategicMergePatchType, []byte(`{"spec":{"paused":false}}`)), nil
+	}
+
+	if d.Spec.Paused {
+		return rolloutPlan{}, fmt.Errorf("cannot roll back a paused Deployment, resume it first")
+	}
+	rsList, err := o.clientset.AppsV1().ReplicaSets(d.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(d.Spec.Selector),
+	})
+	if err != nil {
+		return rolloutPlan{}, err
+	}
+	templates := make(map[int64]*corev1.PodTemplateSpec)
+	replicaSets := make(map[int64]*appsv1.ReplicaSet)
+	var revisions []int64
+	for i := range rsList.Items {
+		rs := &rsList.Items[i]
+		if ref := metav1.GetControllerOf(rs); ref == nil || ref.UID != d.UID {
+			continue
+		}
+		rev, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+		if err != nil {
+			continue
+		}
+		template := rs.Spec.Template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		templates[rev] = template
+		replicaSets[rev] = rs
+		revisions = append(revisions, rev)
+	}
+	sortRevisions(revisions)
+	rev, err := pickRevision(revisions, o.undoRevision)
+	if err != nil {
+		return rolloutPlan{}, err
+	}
+	if apiequality.Semantic.DeepEqual(templates[rev], &d.Spec.Template) {
+		return rolloutPlan{result: fmt.Sprintf("skipped rollback, already at revision %d", rev)}, nil
+	}
+	// the annotations of the revision are restored along with the template
+	annotations := make(map[string]string)
+	for k, v := range d.Annotations {
+		if rollbackSkippedAnnotations[k] {
+			annotations[k] = v
+		}
+	}
+	for k, v := range replicaSets[rev].Annotations {
+		if !rollbackSkippedAnnotations[k] {
+			annotations[k] = v
+		}
+	}
+	data, err := json.Marshal([]map[string]interface{}{
+		{"op": "replace", "path": "/spec/template", "value": templates[rev]},
+		{"op": "replace", "path": "/metadata/annotations", "value": annotations},
+	})
+	if err != nil {
+		return rolloutPlan{}, err
+	}
+	return plan(fmt.Sprintf("rolled back to revision %d", rev), types.JSONPatchType, data), nil
+}
+
+// controllerRevisions returns the revisions of the StatefulSet or DaemonSet,
+// sorted newest first.
+func (o *Options) controllerRevisions(owner metav1.Object, selector *metav1.LabelSelector) ([]*appsv1.ControllerRevision, error) {
+	history, err := o.clientset.AppsV1().ControllerRevisions(owner.GetNamespace()).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(selector),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var revisions []*appsv1.ControllerRevision
+	for i := range history.Items {
+		rev := &history.Items[i]
+		if ref := metav1.GetControllerOf(rev); ref == nil || ref.UID != owner.GetUID() {
+			continue
+		}
+		revisions = append(revisions, rev)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision > revisions[j].Revision
+	})
+	return revisions, nil
+}
+
+// rollbackTo plans the patch of the controller revision, which restores the
+// pod template. It is skipped if the template is already the current one.
+func (o *Options) rollbackTo(owner metav1.Object, selector *metav1.LabelSelector, current *corev1.PodTemplateSpec, plan func(string, []byte) rolloutPlan) (rolloutPlan, error) {
+	history, err := o.controllerRevisions(owner, selector)
+	if err != nil {
+		return rolloutPlan{}, err
+	}
+	patches := make(map[int64][]byte)
+	revisions := make([]int64, 0, len(history))
+	for _, rev := range history {
+		patches[rev.Revision] = rev.Data.Raw
+		revisions = append(revisions, rev.Revision)
+	}
+	rev, err := pickRevision(revisions, o.undoRevision)
+	if err != nil {
+		return rolloutPlan{}, err
+	}
+	// the patch replaces the template of the spec
+	var revision struct {
+		Spec struct {
+			Template corev1.PodTemplateSpec `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(patches[rev], &revision); err != nil {
+		return rolloutPlan{}, fmt.Errorf("decode revision %d: %v", rev, err)
+	}
+	if apiequality.Semantic.DeepEqual(&revision.Spec.Template, current) {
+		return rolloutPlan{result: fmt.Sprintf("skipped rollback, already at revision %d", rev)}, nil
+	}
+	return plan(fmt.Sprintf("rolled back to revision %d", rev), patches[rev]), nil
+}
+
+func (o *Options) rolloutStatefulSet(sts *appsv1.StatefulSet, action string) (rolloutPlan, error) {
+	client := o.clientset.AppsV1().StatefulSets(sts.Namespace)
+	plan := func(result string, data []byte) rolloutPlan {
+		return rolloutPlan{result: result, patch: func() error {
+			_, err := client.Patch(context.TODO(), sts.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{})
+			return err
+		}}
+	}
+
+	switch action {
+	case actionRestart:
+		if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+			return plan("restarted, pods are updated once deleted (OnDelete)", restartPatch()), nil
+		}
+		return plan("restarted", restartPatch()), nil
+	case actionUndo:
+		return o.rollbackTo(sts, sts.Spec.Selector, &sts.Spec.Template, plan)
+	}
+	return rolloutPlan{}, fmt.Errorf("cannot %s, only Deployments can be paused and resumed", action)
+}
+
+func (o *Options) rolloutDaemonSet(ds *appsv1.DaemonSet, action string) (rolloutPlan, error) {
+	client := o.clientset.AppsV1().DaemonSets(ds.Namespace)
+	plan := func(result string, data []byte) rolloutPlan {
+		return rolloutPlan{result: result, patch: func() error {
+			_, err := client.Patch(context.TODO(), ds.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{})
+			return err
+		}}
+	}
+
+	switch action {
+	case actionRestart:
+		if ds.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+			return plan("restarted, pods are updated once deleted (OnDelete)", restartPatch()), nil
+		}
+		return plan("restarted", restartPatch()), nil
+	case actionUndo:
+		return o.rollbackTo(ds, ds.Spec.Selector, &ds.Spec.Template, plan)
+	}
+	return rolloutPlan{}, fmt.Errorf("cannot %s, only Deployments can be paused and resumed", action)
+}
+
+// rolloutStatus describes the progress of the rollout of the target like
+// `kubectl rollout status`, and reports whether it is complete. It fails if
+// the Deployment has exceeded its progress deadline.
+func rolloutStatus(t *target) (string, bool, error) {
+	switch {
+	case t.deployment != nil:
+		d := t.deployment
+		if d.Generation > d.Status.ObservedGeneration {
+			return "waiting for the spec update to be observed", false, nil
+		}
+		for _, cond := range d.Status.Conditions {
+			if cond.Type == appsv1.DeploymentProgressing && cond.Reason == timedOutReason {
+				return "", false, fmt.Errorf("deployment %q exceeded its progress deadline", d.Name)
+			}
+		}
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		switch {
+		case d.Status.UpdatedReplicas < replicas:
+			return fmt.Sprintf("%d out of %d new replicas have been updated", d.Status.UpdatedReplicas, replicas), false, nil
+		case d.Status.Replicas > d.Status.UpdatedReplicas:
+			return fmt.Sprintf("%d old replicas are pending termination", d.Status.Replicas-d.Status.UpdatedReplicas), false, nil
+		case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+			return fmt.Sprintf("%d of %d updated replicas are available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas), false, nil
+		}
+		return "successfully rolled out", true, nil
+
+	case t.statefulSet != nil:
+		sts := t.statefulSet
+		if sts.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+			return "pods are updated once deleted (OnDelete)", true, nil
+		}
+		if sts.Status.ObservedGeneration == 0 || sts.Generation > sts.Status.ObservedGeneration {
+			return "waiting for the spec update to be observed", false, nil
+		}
+		replicas := int32(1)
+		if sts.Spec.Replicas != nil {
+			replicas = *sts.Spec.Replicas
+		}
+		if sts.Status.ReadyReplicas < replicas {
+			return fmt.Sprintf("waiting for %d pods to be ready", replicas-sts.Status.ReadyReplicas), false, nil
+		}
+		if ru := sts.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil && *ru.Partition > 0 {
+			if sts.Status.UpdatedReplicas < replicas-*ru.Partition {
+				return fmt.Sprintf("%d out of %d new pods of the partition have been updated",
+					sts.Status.UpdatedReplicas, replicas-*ru.Partition), false, nil
+			}
+			return fmt.Sprintf("partitioned roll out complete, %d new pods have been updated", sts.Status.UpdatedReplicas), true, nil
+		}
+		if sts.Status.UpdateRevision != sts.Status.CurrentRevision {
+			return fmt.Sprintf("%d out of %d pods are at revision %s", sts.Status.UpdatedReplicas, replicas, sts.Status.UpdateRevision), false, nil
+		}
+		return fmt.Sprintf("rolling update complete, %d pods at revision %s", sts.Status.CurrentReplicas, sts.Status.CurrentRevision), true, nil
+
+	case t.daemonSet != nil:
+		ds := t.daemonSet
+		if ds.Spec.UpdateStrategy.Type != appsv1.RollingUpdateDaemonSetStrategyType {
+			return "pods are updated once deleted (OnDelete)", true, nil
+		}
+		if ds.Generation > ds.Status.ObservedGeneration {
+			return "waiting for the spec update to be observed", false, nil
+		}
+		switch {
+		case ds.Status.UpdatedNumberScheduled < ds.Status.DesiredNumberScheduled:
+			return fmt.Sprintf("%d out of %d new pods have been updated", ds.Status.UpdatedNumberScheduled, ds.Status.DesiredNumberScheduled), false, nil
+		case ds.Status.NumberAvailable < ds.Status.DesiredNumberScheduled:
+			return fmt.Sprintf("%d of %d updated pods are available", ds.Status.NumberAvailable, ds.Status.DesiredNumberScheduled), false, nil
+		}
+		return "successfully rolled out", true, nil
+	}
+	return "", true, nil
+}
+
+// rolloutLines describes the progress of the rollout triggered on the target.
+func (o *Options) rolloutLines(t *target) []string {
+	if !o.rollingOut() {
+		return nil
+	}
+	status, _, err := rolloutStatus(t)
+	if err != nil {
+		return []string{o.highlight(fmt.Sprintf("Rollout failed: %v", err))}
+	}
+	if len(status) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("Rollout: %s", status)}
+}
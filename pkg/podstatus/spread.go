@@ -0,0 +1,269 @@
+package podstatus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/knight42/k8s-tools/pkg/tabwriter"
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+const (
+	groupByNode        = "node"
+	groupByZone        = "zone"
+	groupByLabelPrefix = "label:"
+
+	unscheduled = "<unscheduled>"
+)
+
+func validGroupBy(groupBy string) bool {
+	switch {
+	case groupBy == groupByNode, groupBy == groupByZone:
+		return true
+	case strings.HasPrefix(groupBy, groupByLabelPrefix):
+		return len(strings.TrimPrefix(groupBy, groupByLabelPrefix)) != 0
+	}
+	return false
+}
+
+// fetchNodes refreshes the nodes the pods are grouped by.
+func (o *Options) fetchNodes() error {
+	nodeList, err := o.clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	nodes := make(map[string]*corev1.Node, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes[nodeList.Items[i].Name] = &nodeList.Items[i]
+	}
+	o.clusterNodes = nodes
+	return nil
+}
+
+// groupOf returns the group of the pod given by --group-by.
+func (o *Options) groupOf(pod *corev1.Pod) string {
+	if len(pod.Spec.NodeName) == 0 {
+		return unscheduled
+	}
+	node, ok := o.clusterNodes[pod.Spec.NodeName]
+	switch {
+	case o.groupBy == groupByNode:
+		return pod.Spec.NodeName
+	case !ok:
+		return "<unknown node>"
+	case o.groupBy == groupByZone:
+		return utils.OrNone(utils.NodeZone(node))
+	}
+	return utils.OrNone(node.Labels[strings.TrimPrefix(o.groupBy, groupByLabelPrefix)])
+}
+
+func isReadyReplica(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodRunning && isHealthy(pod)
+}
+
+// spreadLines renders the shown pods aggregated per group, followed by the
+// skew against the spread constraints and the single points of failure,
+// which are checked on all the pods of the target.
+func (o *Options) spreadLines(pods, all []*corev1.Pod) []string {
+	type group struct {
+		pods, ready int
+		nodes       map[string]bool
+	}
+	groups := make(map[string]*group)
+	for _, pod := range pods {
+		key := o.groupOf(pod)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{nodes: make(map[string]bool)}
+			groups[key] = g
+		}
+		g.pods++
+		if isReadyReplica(pod) {
+			g.ready++
+		}
+		if len(pod.Spec.NodeName) != 0 {
+			g.nodes[pod.Spec.NodeName] = true
+		}
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	tw := tabwriter.New(&buf)
+	header := []string{o.groupBy, "pods", "ready"}
+	if o.groupBy != groupByNode {
+		header = append(header, "nodes")
+	}
+	tw.SetHeader(header)
+	for _, key := range keys {
+		g := groups[key]
+		row := []interface{}{key, g.pods, g.ready}
+		if o.groupBy != groupByNode {
+			row = append(row, len(g.nodes))
+		}
+		tw.Append(row...)
+	}
+	_ = tw.Render()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	lines = append(lines, o.spreadViolations(all)...)
+	return append(lines, o.singlePointsOfFailure(all)...)
+}
+
+// topologyDomains counts the scheduled pods matching the selector in each
+// domain of the topology key. The domains are those of the nodes which the
+// pod spec does not exclude by nodeSelector or node affinity.
+func (o *Options) topologyDomains(spec *corev1.PodSpec, key string, selector *metav1.LabelSelector, pods []*corev1.Pod) (map[string]int, error) {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	domains := make(map[string]int)
+	for _, node := range o.clusterNodes {
+		value, ok := node.Labels[key]
+		if _, seen := domains[value]; ok && !seen && len(nodeSelectorMismatch(spec, node)) == 0 {
+			domains[value] = 0
+		}
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || !sel.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		node, ok := o.clusterNodes[pod.Spec.NodeName]
+		if !ok {
+			continue
+		}
+		if value, ok := node.Labels[key]; ok {
+			domains[value]++
+		}
+	}
+	return domains, nil
+}
+
+func domainSkew(domains map[string]int) (skew int, minDomain, maxDomain string) {
+	first := true
+	var minCount, maxCount int
+	for domain, n := range domains {
+		if first || n < minCount || n == minCount && domain < minDomain {
+			minCount, minDomain = n, domain
+		}
+		if first || n > maxCount || n == maxCount && domain < maxDomain {
+			maxCount, maxDomain = n, domain
+		}
+		first = false
+	}
+	return maxCount - minCount, minDomain, maxDomain
+}
+
+// spreadViolations checks the spread of the pods against the
+// topologySpreadConstraints and the pod anti-affinity of the workload, which
+// are taken from the first pod.
+func (o *Options) spreadViolations(pods []*corev1.Pod) []string {
+	if len(pods) == 0 {
+		return nil
+	}
+	spec := &pods[0].Spec
+	flag := func(violated bool) string {
+		if violated {
+			return o.highlight("VIOLATED")
+		}
+		return "ok"
+	}
+
+	var lines []string
+	for _, c := range spec.TopologySpreadConstraints {
+		domains, err := o.topologyDomains(spec, c.TopologyKey, c.LabelSelector, pods)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("Spread on %s: invalid selector: %v", c.TopologyKey, err))
+			continue
+		}
+		if len(domains) == 0 {
+			lines = append(lines, fmt.Sprintf("Spread on %s: no node has the label", c.TopologyKey))
+			continue
+		}
+		skew, minDomain, maxDomain := domainSkew(domains)
+		lines = append(lines, fmt.Sprintf("Spread on %s: skew %d (%d in %s, %d in %s), max skew %d %s, %s",
+			c.TopologyKey, skew, domains[maxDomain], maxDomain, domains[minDomain], minDomain,
+			c.MaxSkew, c.WhenUnsatisfiable, flag(int32(skew) > c.MaxSkew)))
+	}
+
+	if spec.Affinity == nil || spec.Affinity.PodAntiAffinity == nil {
+		return lines
+	}
+	antiAffinity := func(kind string, term corev1.PodAffinityTerm) {
+		domains, err := o.topologyDomains(spec, term.TopologyKey, term.LabelSelector, pods)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s anti-affinity on %s: invalid selector: %v", kind, term.TopologyKey, err))
+			return
+		}
+		var shared []string
+		for domain, n := range domains {
+			if n > 1 {
+				shared = append(shared, fmt.Sprintf("%s (%d)", domain, n))
+			}
+		}
+		sort.Strings(shared)
+		desc := "no domain has more than one pod"
+		if len(shared) > 0 {
+			desc = "shared by " + strings.Join(shared, ", ")
+		}
+		lines = append(lines, fmt.Sprintf("%s anti-affinity on %s: %s, %s", kind, term.TopologyKey, desc, flag(len(shared) > 0)))
+	}
+	for _, term := range spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+		antiAffinity("Required", term)
+	}
+	for _, term := range spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		antiAffinity("Preferred", term.PodAffinityTerm)
+	}
+	return lines
+}
+
+// singlePointsOfFailure flags the zone or node shared by all the ready
+// replicas if there are at least two of them, or the lack of ready replicas
+// if there is more than one replica.
+func (o *Options) singlePointsOfFailure(pods []*corev1.Pod) []string {
+	if len(pods) < 2 {
+		return nil
+	}
+	zones := make(map[string]bool)
+	nodes := make(map[string]bool)
+	ready := 0
+	for _, pod := range pods {
+		if !isReadyReplica(pod) {
+			continue
+		}
+		ready++
+		nodes[pod.Spec.NodeName] = true
+		if node, ok := o.clusterNodes[pod.Spec.NodeName]; ok {
+			zones[utils.NodeZone(node)] = true
+		}
+	}
+	if ready < 2 {
+		return []string{o.highlight(fmt.Sprintf("SPOF: only %d of %d replicas ready", ready, len(pods)))}
+	}
+
+	var lines []string
+	if len(zones) == 1 {
+		for zone := range zones {
+			if len(zone) != 0 {
+				lines = append(lines, o.highlight(fmt.Sprintf("SPOF: all %d ready replicas are in zone %s", ready, zone)))
+			}
+		}
+	}
+	if len(nodes) == 1 {
+		for node := range nodes {
+			lines = append(lines, o.highlight(fmt.Sprintf("SPOF: all %d ready replicas are on node %s", ready, node)))
+		}
+	}
+	return lines
+}
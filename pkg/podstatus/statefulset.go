@@ -0,0 +1,190 @@
+package podstatus
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+// VolumeClaimInfo is a PVC created from a volumeClaimTemplate of the StatefulSet.
+type VolumeClaimInfo struct {
+	Template     string                            `json:"template"`
+	Name         string                            `json:"name"`
+	Phase        corev1.PersistentVolumeClaimPhase `json:"phase"`
+	Capacity     string                            `json:"capacity,omitempty"`
+	StorageClass string                            `json:"storageClass,omitempty"`
+}
+
+// hasStatefulSet reports whether any of the targets is a StatefulSet.
+func (o *Options) hasStatefulSet() bool {
+	for _, t := range o.targets {
+		if t.statefulSet != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchStatefulSets refreshes the StatefulSet targets and their PVCs.
+func (o *Options) fetchStatefulSets() error {
+	for _, t := range o.targets {
+		if t.statefulSet == nil {
+			continue
+		}
+		sts, err := o.clientset.AppsV1().StatefulSets(t.statefulSet.Namespace).Get(context.TODO(), t.statefulSet.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		claims := make(map[string]*corev1.PersistentVolumeClaim)
+		if len(sts.Spec.VolumeClaimTemplates) > 0 {
+			// the controller labels the claims with the matchLabels of the selector
+			pvcs, err := o.clientset.CoreV1().PersistentVolumeClaims(sts.Namespace).List(context.TODO(), metav1.ListOptions{
+				LabelSelector: labels.SelectorFromSet(sts.Spec.Selector.MatchLabels).String(),
+			})
+			if err != nil {
+				return err
+			}
+			for i := range pvcs.Items {
+				claims[pvcs.Items[i].Name] = &pvcs.Items[i]
+			}
+		}
+		t.statefulSet = sts
+		t.claims = claims
+		t.panel = statefulSetPanel(sts)
+	}
+	return nil
+}
+
+// statefulSetPanel describes the revisions and the rolling update progress.
+func statefulSetPanel(sts *appsv1.StatefulSet) []string {
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	lines := []string{
+		fmt.Sprintf("Revisions: current %s, update %s, %d/%d updated",
+			utils.OrNone(sts.Status.CurrentRevision), utils.OrNone(sts.Status.UpdateRevision), sts.Status.UpdatedReplicas, replicas),
+	}
+	switch strategy := sts.Spec.UpdateStrategy; strategy.Type {
+	case appsv1.OnDeleteStatefulSetStrategyType:
+		lines = append(lines, "Update strategy: OnDelete, pods are updated once deleted")
+	default:
+		var partition int32
+		if ru := strategy.RollingUpdate; ru != nil && ru.Partition != nil {
+			partition = *ru.Partition
+		}
+		if partition > 0 {
+			lines = append(lines, fmt.Sprintf("Update strategy: RollingUpdate, partition %d, ordinals %d..%d are updated, %d/%d done",
+				partition, partition, replicas-1, sts.Status.UpdatedReplicas, max32(replicas-partition, 0)))
+		} else {
+			lines = append(lines, "Update strategy: RollingUpdate")
+		}
+	}
+	return lines
+}
+
+func max32(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// podOrdinal returns the ordinal of a pod of a StatefulSet, or false if the
+// pod is not created by a StatefulSet.
+func podOrdinal(pod *corev1.Pod) (string, int, bool) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil || ref.Kind != "StatefulSet" {
+		return "", 0, false
+	}
+	idx := strings.LastIndex(pod.Name, "-")
+	if idx < 0 {
+		return "", 0, false
+	}
+	ordinal, err := strconv.Atoi(pod.Name[idx+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return pod.Name[:idx], ordinal, true
+}
+
+// statefulSetOf returns the StatefulSet target selecting the pod.
+func (o *Options) statefulSetOf(pod *corev1.Pod) *target {
+	for _, t := range o.targets {
+		if t.statefulSet != nil && t.matches(pod) {
+			return t
+		}
+	}
+	return nil
+}
+
+// podRevision returns the revision the pod runs, and whether it is the
+// current or the update revision of the StatefulSet.
+func (o *Options) podRevision(pod *corev1.Pod) string {
+	t := o.statefulSetOf(pod)
+	if t == nil {
+		return ""
+	}
+	rev := pod.Labels[appsv1.ControllerRevisionHashLabelKey]
+	switch {
+	case rev == "":
+		return ""
+	case rev == t.statefulSet.Status.UpdateRevision:
+		return rev + " (update)"
+	case rev == t.statefulSet.Status.CurrentRevision:
+		return rev + " (current)"
+	}
+	return rev + " (old)"
+}
+
+// podVolumeClaims returns the PVCs of the pod created from the volumeClaimTemplates.
+func (o *Options) podVolumeClaims(pod *corev1.Pod) []VolumeClaimInfo {
+	t := o.statefulSetOf(pod)
+	if t == nil {
+		return nil
+	}
+	var infos []VolumeClaimInfo
+	for _, tmpl := range t.statefulSet.Spec.VolumeClaimTemplates {
+		name := fmt.Sprintf("%s-%s", tmpl.Name, pod.Name)
+		info := VolumeClaimInfo{Template: tmpl.Name, Name: name, Phase: "Missing"}
+		if pvc, ok := t.claims[name]; ok {
+			info.Phase = pvc.Status.Phase
+			if q, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+				info.Capacity = q.String()
+			}
+			if pvc.Spec.StorageClassName != nil {
+				info.StorageClass = *pvc.Spec.StorageClassName
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// statefulSetCells returns the revision and pvcs columns, which are empty
+// for the pods of other targets.
+func statefulSetCells(info PodInfo) []interface{} {
+	if len(info.Revision) == 0 && len(info.VolumeClaims) == 0 {
+		return []interface{}{"", ""}
+	}
+	var claims []string
+	for _, c := range info.VolumeClaims {
+		desc := []string{string(c.Phase)}
+		if len(c.Capacity) != 0 {
+			desc = append(desc, c.Capacity)
+		}
+		if len(c.StorageClass) != 0 {
+			desc = append(desc, c.StorageClass)
+		}
+		claims = append(claims, fmt.Sprintf("%s:%s", c.Template, strings.Join(desc, "/")))
+	}
+	return []interface{}{utils.OrNone(info.Revision), utils.OrNone(strings.Join(claims, ","))}
+}
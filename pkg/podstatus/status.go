@@ -0,0 +1,131 @@
+package podstatus
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nodeUnreachablePodReason is the reason set by the node controller on pods
+// of unreachable nodes.
+const nodeUnreachablePodReason = "NodeLost"
+
+// PodSummary is the status of a pod as shown by `kubectl get pods`.
+type PodSummary struct {
+	Phase corev1.PodPhase
+	// Reason is the STATUS column, e.g. Running, CrashLoopBackOff, Init:1/2 or Terminating.
+	Reason string
+	// Ready and Total are the numbers of ready and all app containers.
+	Ready int
+	Total int
+	// Restarts are those of the first unfinished init container while the
+	// pod is initializing, or those of the app containers.
+	Restarts int32
+	// LastTermination is the "reason:exitCode" of the last termination of
+	// the first app container which has terminated before.
+	LastTermination string
+	// InitDone and InitTotal are the numbers of succeeded and all init containers.
+	InitDone     int
+	InitTotal    int
+	Initializing bool
+}
+
+func hasPodReadyCondition(conditions []corev1.PodCondition) bool {
+	for _, cond := range conditions {
+		if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// Compute summarizes the status of the pod, following the printer of kubectl.
+// See also https://github.com/kubernetes/kubernetes/blob/v1.19.0/pkg/printers/internalversion/printers.go#L741
+func Compute(pod *corev1.Pod) PodSummary {
+	s := PodSummary{
+		Phase:     pod.Status.Phase,
+		Reason:    string(pod.Status.Phase),
+		Total:     len(pod.Spec.Containers),
+		InitTotal: len(pod.Spec.InitContainers),
+	}
+	if pod.Status.Reason != "" {
+		s.Reason = pod.Status.Reason
+	}
+
+	for i := range pod.Status.InitContainerStatuses {
+		ct := pod.Status.InitContainerStatuses[i]
+		s.Restarts += ct.RestartCount
+		switch {
+		case ct.State.Terminated != nil && ct.State.Terminated.ExitCode == 0:
+			s.InitDone++
+			continue
+		case ct.State.Terminated != nil:
+			// initialization is failed
+			if len(ct.State.Terminated.Reason) == 0 {
+				if ct.State.Terminated.Signal != 0 {
+					s.Reason = fmt.Sprintf("Init:Signal:%d", ct.State.Terminated.Signal)
+				} else {
+					s.Reason = fmt.Sprintf("Init:ExitCode:%d", ct.State.Terminated.ExitCode)
+				}
+			} else {
+				s.Reason = "Init:" + ct.State.Terminated.Reason
+			}
+		case ct.State.Waiting != nil && len(ct.State.Waiting.Reason) > 0 && ct.State.Waiting.Reason != "PodInitializing":
+			s.Reason = "Init:" + ct.State.Waiting.Reason
+		default:
+			s.Reason = fmt.Sprintf("Init:%d/%d", i, len(pod.Spec.InitContainers))
+		}
+		s.Initializing = true
+		break
+	}
+
+	if !s.Initializing {
+		s.Restarts = 0
+		hasRunning := false
+		for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
+			ct := pod.Status.ContainerStatuses[i]
+
+			s.Restarts += ct.RestartCount
+			if ct.State.Waiting != nil && ct.State.Waiting.Reason != "" {
+				s.Reason = ct.State.Waiting.Reason
+			} else if ct.State.Terminated != nil && ct.State.Terminated.Reason != "" {
+				s.Reason = ct.State.Terminated.Reason
+			} else if ct.State.Terminated != nil && ct.State.Terminated.Reason == "" {
+				if ct.State.Terminated.Signal != 0 {
+					s.Reason = fmt.Sprintf("Signal:%d", ct.State.Terminated.Signal)
+				} else {
+					s.Reason = fmt.Sprintf("ExitCode:%d", ct.State.Terminated.ExitCode)
+				}
+			} else if ct.Ready && ct.State.Running != nil {
+				hasRunning = true
+				s.Ready++
+			}
+		}
+
+		// change pod status back to "Running" if there is at least one container still reporting as "Running" status
+		if s.Reason == "Completed" && hasRunning {
+			if hasPodReadyCondition(pod.Status.Conditions) {
+				s.Reason = "Running"
+			} else {
+				s.Reason = "NotReady"
+			}
+		}
+	}
+
+	if pod.DeletionTimestamp != nil && pod.Status.Reason == nodeUnreachablePodReason {
+		s.Reason = "Unknown"
+	} else if pod.DeletionTimestamp != nil {
+		s.Reason = "Terminating"
+	}
+
+	for _, ct := range pod.Status.ContainerStatuses {
+		if t := ct.LastTerminationState.Terminated; t != nil {
+			s.LastTermination = fmt.Sprintf("%s:%d", t.Reason, t.ExitCode)
+			break
+		} else if w := ct.LastTerminationState.Waiting; w != nil {
+			s.LastTermination = w.Reason
+			break
+		}
+	}
+	return s
+}
@@ -0,0 +1,251 @@
+package podstatus
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func running(ready bool, restarts int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Ready:        ready,
+		RestartCount: restarts,
+		State:        corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}
+}
+
+func waiting(reason string, restarts int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		RestartCount: restarts,
+		State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+	}
+}
+
+func terminated(reason string, exitCode, signal int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			Reason:   reason,
+			ExitCode: exitCode,
+			Signal:   signal,
+		}},
+	}
+}
+
+func newPod(phase corev1.PodPhase, initContainers, containers int) *corev1.Pod {
+	pod := &corev1.Pod{Status: corev1.PodStatus{Phase: phase}}
+	for i := 0; i < initContainers; i++ {
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{})
+	}
+	for i := 0; i < containers; i++ {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{})
+	}
+	return pod
+}
+
+func TestCompute(t *testing.T) {
+	now := metav1.Now()
+
+	testCases := []struct {
+		name   string
+		pod    func() *corev1.Pod
+		expect PodSummary
+	}{
+		{
+			name: "running and ready",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodRunning, 0, 2)
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{running(true, 0), running(true, 3)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodRunning, Reason: "Running", Ready: 2, Total: 2, Restarts: 3},
+		},
+		{
+			name: "pending without statuses",
+			pod: func() *corev1.Pod {
+				return newPod(corev1.PodPending, 0, 1)
+			},
+			expect: PodSummary{Phase: corev1.PodPending, Reason: "Pending", Total: 1},
+		},
+		{
+			name: "pod reason overrides the phase",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodFailed, 0, 1)
+				pod.Status.Reason = "Evicted"
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodFailed, Reason: "Evicted", Total: 1},
+		},
+		{
+			name: "container waiting",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodRunning, 0, 2)
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{running(true, 0), waiting("CrashLoopBackOff", 5)}
+				pod.Status.ContainerStatuses[1].LastTerminationState.Terminated = &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodRunning, Reason: "CrashLoopBackOff", Ready: 1, Total: 2, Restarts: 5, LastTermination: "OOMKilled:137"},
+		},
+		{
+			name: "the first container wins",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodPending, 0, 2)
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{waiting("ImagePullBackOff", 0), waiting("ContainerCreating", 0)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodPending, Reason: "ImagePullBackOff", Total: 2},
+		},
+		{
+			name: "terminated without reason",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodFailed, 0, 1)
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{terminated("", 2, 0)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodFailed, Reason: "ExitCode:2", Total: 1},
+		},
+		{
+			name: "terminated by signal",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodFailed, 0, 1)
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{terminated("", 137, 9)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodFailed, Reason: "Signal:9", Total: 1},
+		},
+		{
+			name: "completed",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodSucceeded, 0, 1)
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{terminated("Completed", 0, 0)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodSucceeded, Reason: "Completed", Total: 1},
+		},
+		{
+			name: "completed with a running and ready sidecar",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodRunning, 0, 2)
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{terminated("Completed", 0, 0), running(true, 0)}
+				pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodRunning, Reason: "Running", Ready: 1, Total: 2},
+		},
+		{
+			name: "completed with a running sidecar but not ready",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodRunning, 0, 2)
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{terminated("Completed", 0, 0), running(true, 0)}
+				pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodRunning, Reason: "NotReady", Ready: 1, Total: 2},
+		},
+		{
+			name: "init containers pending",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodPending, 2, 1)
+				pod.Status.InitContainerStatuses = []corev1.ContainerStatus{waiting("PodInitializing", 0), waiting("PodInitializing", 0)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodPending, Reason: "Init:0/2", Total: 1, InitTotal: 2, Initializing: true},
+		},
+		{
+			name: "second init container running",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodPending, 3, 1)
+				pod.Status.InitContainerStatuses = []corev1.ContainerStatus{terminated("Completed", 0, 0), running(false, 1), waiting("PodInitializing", 0)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodPending, Reason: "Init:1/3", Total: 1, Restarts: 1, InitDone: 1, InitTotal: 3, Initializing: true},
+		},
+		{
+			name: "init container failed with reason",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodPending, 2, 1)
+				pod.Status.InitContainerStatuses = []corev1.ContainerStatus{terminated("Error", 1, 0), waiting("PodInitializing", 0)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodPending, Reason: "Init:Error", Total: 1, InitTotal: 2, Initializing: true},
+		},
+		{
+			name: "init container failed without reason",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodPending, 1, 1)
+				pod.Status.InitContainerStatuses = []corev1.ContainerStatus{terminated("", 3, 0)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodPending, Reason: "Init:ExitCode:3", Total: 1, InitTotal: 1, Initializing: true},
+		},
+		{
+			name: "init container killed by signal",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodPending, 1, 1)
+				pod.Status.InitContainerStatuses = []corev1.ContainerStatus{terminated("", 143, 15)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodPending, Reason: "Init:Signal:15", Total: 1, InitTotal: 1, Initializing: true},
+		},
+		{
+			name: "init container crash looping",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodPending, 2, 1)
+				pod.Status.InitContainerStatuses = []corev1.ContainerStatus{waiting("CrashLoopBackOff", 4), waiting("PodInitializing", 0)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodPending, Reason: "Init:CrashLoopBackOff", Total: 1, Restarts: 4, InitTotal: 2, Initializing: true},
+		},
+		{
+			name: "init containers done",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodRunning, 1, 1)
+				pod.Status.InitContainerStatuses = []corev1.ContainerStatus{terminated("Completed", 0, 0)}
+				pod.Status.InitContainerStatuses[0].RestartCount = 2
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{running(true, 1)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodRunning, Reason: "Running", Ready: 1, Total: 1, Restarts: 1, InitDone: 1, InitTotal: 1},
+		},
+		{
+			name: "terminating",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodRunning, 0, 1)
+				pod.DeletionTimestamp = &now
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{running(true, 0)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodRunning, Reason: "Terminating", Ready: 1, Total: 1},
+		},
+		{
+			name: "terminating while initializing",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodPending, 1, 1)
+				pod.DeletionTimestamp = &now
+				pod.Status.InitContainerStatuses = []corev1.ContainerStatus{waiting("PodInitializing", 0)}
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodPending, Reason: "Terminating", Total: 1, InitTotal: 1, Initializing: true},
+		},
+		{
+			name: "node lost",
+			pod: func() *corev1.Pod {
+				pod := newPod(corev1.PodRunning, 0, 1)
+				pod.DeletionTimestamp = &now
+				pod.Status.Reason = "NodeLost"
+				return pod
+			},
+			expect: PodSummary{Phase: corev1.PodRunning, Reason: "Unknown", Total: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Compute(tc.pod())
+			if !reflect.DeepEqual(got, tc.expect) {
+				t.Errorf("unexpected summary\nexpected: %+v\n     got: %+v", tc.expect, got)
+			}
+		})
+	}
+}
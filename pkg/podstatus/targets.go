@@ -0,0 +1,272 @@
+package podstatus
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// target is a group of pods selected by a workload, a single pod or a label selector.
+type target struct {
+	// lines printed above the pods of the target
+	header []string
+	// empty means all namespaces
+	namespace string
+	selector  labels.Selector
+	// only set if the target is a single pod
+	pod *corev1.Pod
+
+	desiredReplicas *int64
+
+	// only set if the target is a Service
+	service   *corev1.Service
+	endpoints []endpoint
+
+	// only set if the target is given as a HorizontalPodAutoscaler
+	hpaName string
+	// only set if the target is a Deployment
+	deployment *appsv1.Deployment
+	// only set if the target is a CronJob, the Jobs are sorted newest first
+	cronJob *batchv1beta1.CronJob
+	jobs    []*batchv1.Job
+	// only set if the target is a StatefulSet, with the PVCs in its namespace by name
+	statefulSet *appsv1.StatefulSet
+	claims      map[string]*corev1.PersistentVolumeClaim
+	// only set if the target is a DaemonSet, with every node of the cluster
+	daemonSet      *appsv1.DaemonSet
+	updateRevision string
+	nodes          []corev1.Node
+	// lines describing the HPA, the CronJob or the StatefulSet, refreshed in watch mode
+	panel []string
+}
+
+func (t *target) matches(pod *corev1.Pod) bool {
+	if len(t.namespace) != 0 && pod.Namespace != t.namespace {
+		return false
+	}
+	if t.pod != nil {
+		return pod.UID == t.pod.UID
+	}
+	if t.cronJob != nil {
+		// the pods of every Job share the labels of the job template
+		ref := metav1.GetControllerOf(pod)
+		if ref == nil {
+			return false
+		}
+		for _, job := range t.jobs {
+			if job.UID == ref.UID {
+				return true
+			}
+		}
+		return false
+	}
+	return t.selector.Matches(labels.Set(pod.Labels))
+}
+
+// listOptions returns the label and field selectors to list the pods of the target.
+func (t *target) listOptions() (labelSelector, fieldSelector string) {
+	if t.pod != nil {
+		return "", fields.OneTermEqualSelector("metadata.name", t.pod.Name).String()
+	}
+	return t.selector.String(), ""
+}
+
+func kindOf(obj runtime.Object) string {
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil || len(gvks) == 0 {
+		return "Object"
+	}
+	return gvks[0].Kind
+}
+
+func newSelectorTarget(namespace, selector string) (*target, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	return &target{
+		header:    []string{fmt.Sprintf("Selector: -l%s", selector)},
+		namespace: namespace,
+		selector:  sel,
+	}, nil
+}
+
+func (o *Options) newObjectTarget(obj runtime.Object) (*target, error) {
+	var hpaName string
+	if isHPA(obj) {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		hpaName = accessor.GetName()
+		obj, err = getRefObject(obj, o.configFlags)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	kindHeader := fmt.Sprintf("%s: %s/%s", kindOf(obj), accessor.GetNamespace(), accessor.GetName())
+
+	if pod, ok := obj.(*corev1.Pod); ok {
+		return &target{
+			header:    []string{kindHeader},
+			namespace: pod.Namespace,
+			selector:  labels.Everything(),
+			pod:       pod,
+		}, nil
+	}
+
+	selector, err := getSelectorFromObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newSelectorTarget(accessor.GetNamespace(), selector)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid selector: %v", kindHeader, err)
+	}
+	t.header = append([]string{kindHeader}, t.header...)
+	if replicas, ok := desiredReplicas(obj); ok {
+		t.desiredReplicas = &replicas
+	}
+	switch actual := obj.(type) {
+	case *corev1.Service:
+		t.service = actual
+	case *appsv1.Deployment:
+		t.deployment = actual
+	case *batchv1beta1.CronJob:
+		t.cronJob = actual
+	case *appsv1.StatefulSet:
+		t.statefulSet = actual
+	case *appsv1.DaemonSet:
+		t.daemonSet = actual
+	}
+	t.hpaName = hpaName
+	return t, nil
+}
+
+// resolveTargets turns the workloads given as arguments and the label
+// selector into targets, in the order they are given.
+func (o *Options) resolveTargets() ([]*target, error) {
+	var targets []*target
+
+	if len(o.args) != 0 {
+		r := newBuilder(o.configFlags).
+			NamespaceParam(o.namespace).DefaultNamespace().AllNamespaces(o.allNamespaces).
+			ResourceTypeOrNameArgs(true, o.args...).
+			Flatten().
+			Do()
+		if err := r.Err(); err != nil {
+			return nil, err
+		}
+		err := r.Visit(func(info *resource.Info, err error) error {
+			if err != nil {
+				return err
+			}
+			t, err := o.newObjectTarget(info.Object)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, t)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(o.labelSelector) != 0 {
+		namespace := o.namespace
+		if o.allNamespaces {
+			namespace = ""
+		}
+		t, err := newSelectorTarget(namespace, o.labelSelector)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no resources found")
+	}
+	return targets, nil
+}
+
+// listPods returns the pods of the target.
+func (o *Options) listPods(t *target) ([]*corev1.Pod, error) {
+	labelSelector, fieldSelector := t.listOptions()
+	r := newBuilder(o.configFlags).
+		NamespaceParam(t.namespace).DefaultNamespace().AllNamespaces(len(t.namespace) == 0).
+		LabelSelector(labelSelector).
+		FieldSelectorParam(fieldSelector).
+		SelectAllParam(len(labelSelector) == 0 && len(fieldSelector) == 0).
+		ResourceTypes("pods").
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	var pods []*corev1.Pod
+	err := r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		pod, ok := info.Object.(*corev1.Pod)
+		if !ok {
+			return fmt.Errorf("object is not a Pod: %#v", info.Object)
+		}
+		if t.matches(pod) {
+			pods = append(pods, pod)
+		}
+		return nil
+	})
+	return pods, err
+}
+
+// groupPods splits the pods by the targets they belong to.
+func (o *Options) groupPods(pods []*corev1.Pod) [][]*corev1.Pod {
+	groups := make([][]*corev1.Pod, len(o.targets))
+	for i, t := range o.targets {
+		for _, pod := range pods {
+			if t.matches(pod) {
+				groups[i] = append(groups[i], pod)
+			}
+		}
+	}
+	return groups
+}
+
+// targetFooter returns the lines printed under the pods of the target, which
+// are given before filtering.
+func (o *Options) targetFooter(t *target, pods []*corev1.Pod) []string {
+	lines := append(staleEndpoints(t, pods), daemonSetCoverage(t, pods)...)
+	return append(lines, o.rolloutLines(t)...)
+}
+
+// printTargetHeader prints the lines describing the target above its pods,
+// followed by the HPA panel if withPanel is true.
+func (o *Options) printTargetHeader(t *target, withPanel bool) {
+	lines := t.header
+	if withPanel {
+		lines = append(lines[:len(lines):len(lines)], t.panel...)
+	}
+	for _, line := range lines {
+		o.infof("%s\n", line)
+	}
+	o.infof("\n")
+}
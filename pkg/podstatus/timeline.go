@@ -0,0 +1,174 @@
+package podstatus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+
+	"github.com/knight42/k8s-tools/pkg/tabwriter"
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+const statusDeleted = "Deleted"
+
+// Transition is a change of the computed status of a pod, as shown in the
+// STATUS, READY, RESTARTS and NODE columns.
+type Transition struct {
+	Time           time.Time `json:"time"`
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	PreviousStatus string    `json:"previousStatus,omitempty"`
+	Status         string    `json:"status"`
+	Ready          string    `json:"ready"`
+	Restarts       int32     `json:"restarts"`
+	Node           string    `json:"node,omitempty"`
+}
+
+func (t *Transition) sameAs(other *Transition) bool {
+	return t.Status == other.Status &&
+		t.Ready == other.Ready &&
+		t.Restarts == other.Restarts &&
+		t.Node == other.Node
+}
+
+type podTimeline struct {
+	pod          *corev1.Pod
+	last         *Transition
+	restartTimes []time.Time
+}
+
+// timeline records the transitions of the watched pods.
+type timeline struct {
+	out  io.Writer
+	file *os.File
+	pods map[string]*podTimeline
+}
+
+func newTimeline(out io.Writer, path string) (*timeline, error) {
+	t := &timeline{
+		out:  out,
+		pods: make(map[string]*podTimeline),
+	}
+	if len(path) != 0 {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		t.file = f
+	}
+	return t, nil
+}
+
+func (t *timeline) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+// observe records the state of the pod seen at the given time if it differs
+// from the previous one.
+func (t *timeline) observe(pod *corev1.Pod, deleted bool, now time.Time) error {
+	info := newPodInfo(pod)
+	tr := &Transition{
+		Time:      now,
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Status:    info.Status,
+		Ready:     info.Ready,
+		Restarts:  info.Restarts,
+		Node:      info.Node,
+	}
+	if deleted {
+		tr.Status = statusDeleted
+	}
+
+	uid := string(pod.UID)
+	pt, ok := t.pods[uid]
+	if !ok {
+		pt = &podTimeline{}
+		t.pods[uid] = pt
+	}
+	pt.pod = pod
+	if pt.last != nil {
+		if pt.last.sameAs(tr) {
+			return nil
+		}
+		tr.PreviousStatus = pt.last.Status
+		if tr.Restarts > pt.last.Restarts {
+			pt.restartTimes = append(pt.restartTimes, now)
+		}
+	}
+	pt.last = tr
+
+	if t.file != nil {
+		if err := json.NewEncoder(t.file).Encode(tr); err != nil {
+			return err
+		}
+	}
+	return t.print(tr)
+}
+
+func (t *timeline) print(tr *Transition) error {
+	status := tr.Status
+	if len(tr.PreviousStatus) != 0 {
+		status = tr.PreviousStatus + " → " + tr.Status
+	}
+	_, err := fmt.Fprintf(t.out, "%s  %s  %s  ready=%s restarts=%d node=%s\n",
+		tr.Time.Format(time.RFC3339), tr.Name, status, tr.Ready, tr.Restarts, utils.OrNone(tr.Node))
+	return err
+}
+
+func conditionTime(pod *corev1.Pod, condType corev1.PodConditionType) *time.Time {
+	cond := getCondition(pod, condType)
+	if cond == nil || cond.Status != corev1.ConditionTrue || cond.LastTransitionTime.IsZero() {
+		return nil
+	}
+	return &cond.LastTransitionTime.Time
+}
+
+func sinceCreation(pod *corev1.Pod, t *time.Time) string {
+	if t == nil {
+		return "<none>"
+	}
+	return duration.HumanDuration(t.Sub(pod.CreationTimestamp.Time))
+}
+
+// printSummary reports per pod how long it took to be scheduled and to become
+// ready, and when it restarted, relative to its creation.
+func (t *timeline) printSummary() error {
+	pts := make([]*podTimeline, 0, len(t.pods))
+	for _, pt := range t.pods {
+		pts = append(pts, pt)
+	}
+	sort.Slice(pts, func(i, j int) bool {
+		return pts[i].pod.Name < pts[j].pod.Name
+	})
+
+	tw := tabwriter.New(t.out)
+	tw.SetHeader([]string{"name", "status", "time to scheduled", "time to ready", "restarts", "restarted at"})
+	for _, pt := range pts {
+		pod := pt.pod
+		var restartedAt []string
+		for i := range pt.restartTimes {
+			restartedAt = append(restartedAt, "+"+sinceCreation(pod, &pt.restartTimes[i]))
+		}
+		tw.Append(
+			pod.Name,
+			pt.last.Status,
+			sinceCreation(pod, conditionTime(pod, corev1.PodScheduled)),
+			sinceCreation(pod, conditionTime(pod, corev1.PodReady)),
+			pt.last.Restarts,
+			utils.OrNone(strings.Join(restartedAt, ",")),
+		)
+	}
+	_, _ = fmt.Fprintln(t.out)
+	return tw.Render()
+}
@@ -0,0 +1,172 @@
+package podstatus
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsv1beta1api "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+// ResourceUsage is the live usage of a pod or container reported by
+// metrics-server along with its requests and limits.
+type ResourceUsage struct {
+	CPUUsageMillis      int64 `json:"cpuUsageMillis"`
+	CPURequestsMillis   int64 `json:"cpuRequestsMillis"`
+	CPULimitsMillis     int64 `json:"cpuLimitsMillis"`
+	MemoryUsageBytes    int64 `json:"memoryUsageBytes"`
+	MemoryRequestsBytes int64 `json:"memoryRequestsBytes"`
+	MemoryLimitsBytes   int64 `json:"memoryLimitsBytes"`
+}
+
+func newResourceUsage(usage, reqs, limits corev1.ResourceList) *ResourceUsage {
+	return &ResourceUsage{
+		CPUUsageMillis:      usage.Cpu().MilliValue(),
+		CPURequestsMillis:   reqs.Cpu().MilliValue(),
+		CPULimitsMillis:     limits.Cpu().MilliValue(),
+		MemoryUsageBytes:    usage.Memory().Value(),
+		MemoryRequestsBytes: reqs.Memory().Value(),
+		MemoryLimitsBytes:   limits.Memory().Value(),
+	}
+}
+
+func memoryInMB(bytes int64) int64 {
+	return bytes / (1024 * 1024)
+}
+
+// fraction returns used/total in percent, or 0 if total is unset.
+func fraction(used, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(used) / float64(total) * 100
+}
+
+// withFraction formats a request or limit along with the percentage of it being used.
+func withFraction(used, total int64, formatted string) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s(%.1f%%)", formatted, fraction(used, total))
+}
+
+func (u *ResourceUsage) cpuCell() string {
+	if u == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("%dm/%s/%s",
+		u.CPUUsageMillis,
+		withFraction(u.CPUUsageMillis, u.CPURequestsMillis, fmt.Sprintf("%dm", u.CPURequestsMillis)),
+		withFraction(u.CPUUsageMillis, u.CPULimitsMillis, fmt.Sprintf("%dm", u.CPULimitsMillis)),
+	)
+}
+
+func (u *ResourceUsage) memoryCell() string {
+	if u == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("%dMi/%s/%s",
+		memoryInMB(u.MemoryUsageBytes),
+		withFraction(u.MemoryUsageBytes, u.MemoryRequestsBytes, fmt.Sprintf("%dMi", memoryInMB(u.MemoryRequestsBytes))),
+		withFraction(u.MemoryUsageBytes, u.MemoryLimitsBytes, fmt.Sprintf("%dMi", memoryInMB(u.MemoryLimitsBytes))),
+	)
+}
+
+// oomRisk reports whether the memory usage is close to the memory limit.
+func (u *ResourceUsage) oomRisk(threshold float64) bool {
+	if u == nil || u.MemoryLimitsBytes == 0 {
+		return false
+	}
+	return fraction(u.MemoryUsageBytes, u.MemoryLimitsBytes) >= threshold
+}
+
+// usageCells returns the CPU and memory columns. The memory column is always
+// the last one of a row, so highlighting it does not break the alignment.
+func (o *Options) usageCells(u *ResourceUsage) []interface{} {
+	mem := u.memoryCell()
+	if u.oomRisk(o.oomThreshold) {
+		mem = o.highlight(mem + " OOM-RISK")
+	}
+	return []interface{}{u.cpuCell(), mem}
+}
+
+func podMetricsKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// fetchPodMetrics refreshes the usage of the pods of every target.
+func (o *Options) fetchPodMetrics() error {
+	podMetrics := make(map[string]*metricsv1beta1api.PodMetrics)
+	for _, t := range o.targets {
+		cli := o.metricsClient.MetricsV1beta1().PodMetricses(t.namespace)
+
+		var items []metricsv1beta1api.PodMetrics
+		if t.pod != nil {
+			m, err := cli.Get(context.TODO(), t.pod.Name, metav1.GetOptions{})
+			switch {
+			case apierrors.IsNotFound(err):
+				// pending or just started, metrics-server has not scraped it yet
+			case err != nil:
+				return err
+			default:
+				items = []metricsv1beta1api.PodMetrics{*m}
+			}
+		} else {
+			ml, err := cli.List(context.TODO(), metav1.ListOptions{LabelSelector: t.selector.String()})
+			if err != nil {
+				return err
+			}
+			items = ml.Items
+		}
+
+		for i := range items {
+			m := &items[i]
+			podMetrics[podMetricsKey(m.Namespace, m.Name)] = m
+		}
+	}
+	o.podMetrics = podMetrics
+	return nil
+}
+
+// loadPodMetrics fetches the usage once. The usage is shown as <none> if
+// metrics-server is unavailable, rather than failing the whole command.
+func (o *Options) loadPodMetrics() {
+	if err := o.fetchPodMetrics(); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to fetch pod metrics: %v\n", err)
+	}
+}
+
+func (o *Options) podUsage(pod *corev1.Pod) *ResourceUsage {
+	m, ok := o.podMetrics[podMetricsKey(pod.Namespace, pod.Name)]
+	if !ok {
+		return nil
+	}
+	usage := corev1.ResourceList{}
+	for _, c := range m.Containers {
+		for name, q := range c.Usage {
+			total := usage[name]
+			total.Add(q)
+			usage[name] = total
+		}
+	}
+	reqs, limits := utils.PodRequestsAndLimits(pod)
+	return newResourceUsage(usage, reqs, limits)
+}
+
+func (o *Options) containerUsage(pod *corev1.Pod, container *corev1.Container) *ResourceUsage {
+	m, ok := o.podMetrics[podMetricsKey(pod.Namespace, pod.Name)]
+	if !ok {
+		return nil
+	}
+	for _, c := range m.Containers {
+		if c.Name == container.Name {
+			return newResourceUsage(c.Usage, container.Resources.Requests, container.Resources.Limits)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package podstatus
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/knight42/k8s-tools/pkg/utils"
+)
+
+const (
+	exitCodeFailed  = 1
+	exitCodeTimeout = 2
+	// exitCodeInterrupted follows the shell convention of 128+SIGINT.
+	exitCodeInterrupted = 130
+)
+
+// desiredReplicas returns the number of pods the workload is supposed to run.
+func desiredReplicas(obj runtime.Object) (int64, bool) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return 0, false
+	}
+	if replicas, found, err := unstructured.NestedInt64(u, "spec", "replicas"); found && err == nil {
+		return replicas, true
+	}
+	// DaemonSet
+	if desired, found, err := unstructured.NestedInt64(u, "status", "desiredNumberScheduled"); found && err == nil {
+		return desired, true
+	}
+	return 0, false
+}
+
+func (o *Options) isFailureState(status string) bool {
+	status = strings.TrimPrefix(status, "Init:")
+	for _, s := range o.failureStates {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// readinessSummary describes how far the selected pods are from being ready.
+func (o *Options) readinessSummary() string {
+	var (
+		ready    int
+		notReady []string
+	)
+	for _, pod := range o.pods {
+		if pod.DeletionTimestamp == nil && isHealthy(pod) {
+			ready++
+			continue
+		}
+		notReady = append(notReady, fmt.Sprintf("%s(%s)", pod.Name, newPodInfo(pod).Status))
+	}
+	sort.Strings(notReady)
+
+	summary := fmt.Sprintf("%d/%d pods ready", ready, len(o.pods))
+	var desired int64
+	for _, t := range o.targets {
+		if t.desiredReplicas != nil {
+			desired += *t.desiredReplicas
+		}
+	}
+	if desired > 0 {
+		summary += fmt.Sprintf(", %d desired", desired)
+	}
+	if len(notReady) > 0 {
+		summary += ", not ready: " + strings.Join(notReady, ", ")
+	}
+	return summary
+}
+
+// workloadReady reports whether the Deployment, StatefulSet or DaemonSet of
+// the target has all its replicas updated and ready according to its status,
+// which the pods alone cannot tell during a rolling update. ok is false if
+// the target is none of them.
+func workloadReady(t *target) (ready, ok bool, err error) {
+	switch {
+	case t.deployment != nil:
+		_, done, err := rolloutStatus(t)
+		return done, true, err
+
+	case t.statefulSet != nil:
+		sts := t.statefulSet
+		if sts.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType {
+			_, done, err := rolloutStatus(t)
+			return done, true, err
+		}
+		replicas := int32(1)
+		if sts.Spec.Replicas != nil {
+			replicas = *sts.Spec.Replicas
+		}
+		return sts.Status.ObservedGeneration >= sts.Generation && sts.Status.ReadyReplicas >= replicas, true, nil
+
+	case t.daemonSet != nil:
+		ds := t.daemonSet
+		if ds.Spec.UpdateStrategy.Type == appsv1.RollingUpdateDaemonSetStrategyType {
+			_, done, err := rolloutStatus(t)
+			return done, true, err
+		}
+		return ds.Status.ObservedGeneration >= ds.Generation && ds.Status.NumberReady >= ds.Status.DesiredNumberScheduled, true, nil
+	}
+	return false, false, nil
+}
+
+// checkReady reports whether every selected pod is ready and every target is
+// done. A workload is done once its status says so, and any other target once
+// it has the desired number of pods, which a target scaled to 0 has without
+// pods. It fails as soon as a pod enters a failure state, or a Deployment
+// exceeds its progress deadline.
+func (o *Options) checkReady() (bool, error) {
+	ready := 0
+	for _, pod := range o.pods {
+		status := newPodInfo(pod).Status
+		if o.isFailureState(status) {
+			return false, &utils.ExitError{
+				Code: exitCodeFailed,
+				Err:  fmt.Errorf("pod %s entered %s: %s", pod.Name, status, o.readinessSummary()),
+			}
+		}
+		if pod.DeletionTimestamp == nil && isHealthy(pod) {
+			ready++
+		}
+	}
+
+	done := ready == len(o.pods)
+	for i, pods := range o.groupPods(o.sortedPods()) {
+		t := o.targets[i]
+		if updated, ok, err := workloadReady(t); err != nil {
+			return false, &utils.ExitError{Code: exitCodeFailed, Err: err}
+		} else if ok {
+			done = done && updated
+			continue
+		}
+		if t.desiredReplicas == nil {
+			// the target wants pods, though how many is unknown
+			done = done && len(pods) > 0
+			continue
+		}
+		// a target scaled to 0 is done once its pods are gone
+		done = done && int64(len(pods)) >= *t.desiredReplicas
+	}
+	return done, nil
+}
+
+func (o *Options) waitTimeoutError() error {
+	return &utils.ExitError{
+		Code: exitCodeTimeout,
+		Err:  fmt.Errorf("timed out after %s waiting for pods to be ready: %s", o.timeout, o.readinessSummary()),
+	}
+}
+
+func (o *Options) interruptedError() error {
+	return &utils.ExitError{
+		Code: exitCodeInterrupted,
+		Err:  fmt.Errorf("interrupted while waiting for pods to be ready: %s", o.readinessSummary()),
+	}
+}
@@ -0,0 +1,350 @@
+package podstatus
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// contextInterval is how often the endpoints and panels are refreshed in watch mode.
+const contextInterval = 5 * time.Second
+
+type podEvent struct {
+	eventType watch.EventType
+	pod       *corev1.Pod
+}
+
+type watchError struct {
+	informer cache.SharedIndexInformer
+	err      error
+	// the error does not go away by retrying, like Forbidden
+	permanent bool
+}
+
+func isPermanent(err error) bool {
+	return apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err)
+}
+
+// newPodInformer returns an informer which relists and resumes watching the
+// pods of the target after the watch times out, the connection breaks or the
+// resource version expires. The handlers give up sending the events once
+// stopCh is closed, so they are not blocked after we stop reading them.
+func (o *Options) newPodInformer(t *target, events chan<- podEvent, watchErrs chan<- watchError, stopCh <-chan struct{}) (cache.SharedIndexInformer, error) {
+	labelSelector, fieldSelector := t.listOptions()
+	lw := cache.NewFilteredListWatchFromClient(
+		o.clientset.CoreV1().RESTClient(),
+		"pods",
+		t.namespace,
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = labelSelector
+			options.FieldSelector = fieldSelector
+		},
+	)
+	informer := cache.NewSharedIndexInformer(lw, &corev1.Pod{}, 0, cache.Indexers{})
+
+	// the reflector flattens the errors into strings, check them as they are returned
+	reportPermanent := func(err error) {
+		if isPermanent(err) {
+			select {
+			case watchErrs <- watchError{informer: informer, err: err, permanent: true}:
+			default:
+			}
+		}
+	}
+	list, watchFunc := lw.ListFunc, lw.WatchFunc
+	lw.ListFunc = func(options metav1.ListOptions) (runtime.Object, error) {
+		obj, err := list(options)
+		reportPermanent(err)
+		return obj, err
+	}
+	lw.WatchFunc = func(options metav1.ListOptions) (watch.Interface, error) {
+		w, err := watchFunc(options)
+		reportPermanent(err)
+		return w, err
+	}
+
+	send := func(ev podEvent) {
+		select {
+		case events <- ev:
+		case <-stopCh:
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			send(podEvent{eventType: watch.Added, pod: obj.(*corev1.Pod)})
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			send(podEvent{eventType: watch.Modified, pod: obj.(*corev1.Pod)})
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				send(podEvent{eventType: watch.Deleted, pod: pod})
+			}
+		},
+	})
+	err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		select {
+		case watchErrs <- watchError{informer: informer, err: err}:
+		default:
+		}
+	})
+	return informer, err
+}
+
+func (o *Options) watchPods() error {
+	events := make(chan podEvent)
+	watchErrs := make(chan watchError, len(o.targets))
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	informers := make([]cache.SharedIndexInformer, len(o.targets))
+	hasSynced := make([]cache.InformerSynced, len(o.targets))
+	for i, t := range o.targets {
+		informer, err := o.newPodInformer(t, events, watchErrs, stopCh)
+		if err != nil {
+			return err
+		}
+		go informer.Run(stopCh)
+		informers[i] = informer
+		hasSynced[i] = informer.HasSynced
+	}
+
+	synced := make(chan struct{})
+	go func() {
+		if cache.WaitForCacheSync(stopCh, hasSynced...) {
+			close(synced)
+		}
+	}()
+	// the informers keep relisting until they sync, unless retrying is futile
+	for waiting := true; waiting; {
+		select {
+		case <-synced:
+			waiting = false
+		case werr := <-watchErrs:
+			if werr.permanent {
+				return werr.err
+			}
+			o.setReconnecting(werr.err.Error())
+		}
+	}
+
+	// resource versions of the pods we know about, so that the events replayed
+	// by the informers after a relist, or by another target selecting the same
+	// pod, do not show up as changes.
+	known := make(map[string]string)
+	for _, informer := range informers {
+		for _, obj := range informer.GetStore().List() {
+			pod := obj.(*corev1.Pod)
+			known[string(pod.UID)] = pod.ResourceVersion
+			if !o.watchOnly {
+				o.pods[string(pod.UID)] = pod
+			}
+		}
+	}
+	if o.showTimeline {
+		tl, err := newTimeline(o.out, o.timelineFile)
+		if err != nil {
+			return err
+		}
+		o.timeline = tl
+		defer o.timeline.Close()
+		if o.timelineSum {
+			defer o.timeline.printSummary()
+		}
+		if !o.watchOnly {
+			now := time.Now()
+			for _, pod := range o.sortedPods() {
+				if err := o.timeline.observe(pod, false, now); err != nil {
+					return err
+				}
+			}
+		}
+	} else if o.logs {
+		o.logTailer = newLogTailer(o, true)
+		defer o.logTailer.Close()
+		for _, pod := range o.sortedPods() {
+			o.logTailer.observe(pod, false, true)
+		}
+	} else {
+		if o.printer == nil {
+			o.screen = newScreen(o.out)
+		}
+		if !o.watchOnly {
+			o.printPods()
+		}
+	}
+	if o.waitReady {
+		if done, err := o.checkReady(); done || err != nil {
+			return err
+		}
+	}
+
+	var refresh <-chan time.Time
+	if o.showUsage {
+		ticker := time.NewTicker(o.usageInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	var refreshContext <-chan time.Time
+	if o.hasContext() {
+		ticker := time.NewTicker(contextInterval)
+		defer ticker.Stop()
+		refreshContext = ticker.C
+	}
+
+	var timeout <-chan time.Time
+	if o.waitReady && o.timeout > 0 {
+		timer := time.NewTimer(o.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	defer signal.Stop(resize)
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	// resource versions when the watches broke, a reflector has recovered once it moves on
+	brokenAt := make(map[cache.SharedIndexInformer]string)
+	healthCheck := time.NewTicker(time.Second)
+	defer healthCheck.Stop()
+
+	for {
+		select {
+		case ev := <-events:
+			if o.setReconnecting("") {
+				o.printPods()
+			}
+
+			pod := ev.pod
+			uid := string(pod.UID)
+			if ev.eventType == watch.Deleted {
+				if _, ok := known[uid]; !ok {
+					continue
+				}
+				delete(known, uid)
+				delete(o.pods, uid)
+			} else {
+				if known[uid] == pod.ResourceVersion {
+					continue
+				}
+				known[uid] = pod.ResourceVersion
+				o.pods[uid] = pod
+			}
+
+			if o.timeline != nil {
+				if err := o.timeline.observe(pod, ev.eventType == watch.Deleted, time.Now()); err != nil {
+					return err
+				}
+			} else if o.logTailer != nil {
+				o.logTailer.observe(pod, ev.eventType == watch.Deleted, false)
+			} else if o.screen == nil && len(o.groupBy) != 0 {
+				// not a terminal, print the groups again as they change
+				fmt.Fprintln(o.out)
+				o.printPods()
+			} else if o.screen == nil {
+				// not a terminal, print the changed pod alone as a change log
+				if o.matchesFilters(pod) {
+					if err := o.PrintPod(pod, true); err != nil {
+						return err
+					}
+				}
+			} else {
+				o.printPods()
+			}
+			if o.waitReady {
+				if done, err := o.checkReady(); done || err != nil {
+					return err
+				}
+			}
+
+		case werr := <-watchErrs:
+			if werr.permanent {
+				return werr.err
+			}
+			brokenAt[werr.informer] = werr.informer.LastSyncResourceVersion()
+			if o.setReconnecting(werr.err.Error()) {
+				o.printPods()
+			}
+
+		case <-healthCheck.C:
+			for informer, rv := range brokenAt {
+				if informer.LastSyncResourceVersion() != rv {
+					delete(brokenAt, informer)
+				}
+			}
+			if len(brokenAt) == 0 && o.setReconnecting("") {
+				o.printPods()
+			}
+
+		case <-resize:
+			if o.screen != nil {
+				o.printPods()
+			}
+
+		case <-timeout:
+			return o.waitTimeoutError()
+
+		case <-interrupted:
+			if o.waitReady {
+				return o.interruptedError()
+			}
+			return nil
+
+		case <-refresh:
+			// keep showing the stale numbers if metrics-server is temporarily unavailable
+			if err := o.fetchPodMetrics(); err != nil {
+				continue
+			}
+			if o.screen != nil {
+				o.printPods()
+			}
+
+		case <-refreshContext:
+			if err := o.fetchContext(); err != nil {
+				continue
+			}
+			if o.screen != nil {
+				o.printPods()
+			}
+			if o.waitReady {
+				// the rollouts complete with the status of the workloads
+				if done, err := o.checkReady(); done || err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// setReconnecting records why the watch is broken, or that it has recovered
+// if reason is empty. It reports whether the table needs to be redrawn.
+func (o *Options) setReconnecting(reason string) bool {
+	if o.reconnecting == reason {
+		return false
+	}
+	o.reconnecting = reason
+	if o.screen == nil {
+		if len(reason) != 0 {
+			fmt.Fprintf(os.Stderr, "watch broken, reconnecting: %s\n", reason)
+		}
+		return false
+	}
+	return true
+}
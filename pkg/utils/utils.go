@@ -2,12 +2,60 @@ package utils
 
 import (
 	"fmt"
+	"io"
 	"os"
+
+	"github.com/morikuni/aec"
+	"golang.org/x/crypto/ssh/terminal"
+	corev1 "k8s.io/api/core/v1"
 )
 
+// ExitError terminates the program with the given exit code instead of 1.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
 func CheckError(err error) {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		if exitErr, ok := err.(*ExitError); ok {
+			os.Exit(exitErr.Code)
+		}
 		os.Exit(1)
 	}
 }
+
+// IsTerminal reports whether the output is a terminal.
+func IsTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	return ok && terminal.IsTerminal(int(f.Fd()))
+}
+
+// Highlight colors the text red if the output is a terminal.
+func Highlight(out io.Writer, s string) string {
+	if IsTerminal(out) {
+		return aec.RedF.Apply(s)
+	}
+	return s
+}
+
+// OrNone returns <none> in place of an empty value.
+func OrNone(s string) string {
+	if len(s) == 0 {
+		return "<none>"
+	}
+	return s
+}
+
+// NodeZone returns the zone of the node, from the stable label if present.
+func NodeZone(node *corev1.Node) string {
+	if zone, ok := node.Labels[corev1.LabelZoneFailureDomainStable]; ok {
+		return zone
+	}
+	return node.Labels[corev1.LabelZoneFailureDomain]
+}